@@ -0,0 +1,101 @@
+package gitreader
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// git refuses to follow alternates nested deeper than this
+const maxAlternateDepth = 5
+
+// Read objects/info/alternates in the objects directory dir and
+// return the alternate object directories it lists. Relative paths
+// are relative to dir.
+func readAlternates(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, "info", "alternates"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var dirs []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		// Paths with unusual characters are C-style quoted
+		if line[0] == '"' {
+			if unquoted, err := strconv.Unquote(line); err == nil {
+				line = unquoted
+			}
+		}
+
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+
+		dirs = append(dirs, filepath.Clean(line))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return dirs, nil
+}
+
+// Build the Loaders for each alternate of the objects directory dir,
+// following nested alternates. Stores that have already been seen
+// are skipped so that cycles terminate, and stores that don't exist
+// are ignored like git does.
+func loadAlternates(dir string, format *ObjectFormat, seen map[string]bool, depth int) ([]Loader, error) {
+	dirs, err := readAlternates(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dirs) > 0 && depth >= maxAlternateDepth {
+		return nil, nil
+	}
+
+	var loaders []Loader
+
+	for _, alt := range dirs {
+		abs, err := filepath.Abs(alt)
+		if err != nil {
+			closeLoaders(loaders)
+			return nil, err
+		}
+
+		if seen[abs] {
+			continue
+		}
+
+		if info, err := os.Stat(alt); err != nil || !info.IsDir() {
+			continue
+		}
+
+		altLoaders, err := loadObjectsDir(alt, format, seen, depth+1)
+		if err != nil {
+			closeLoaders(loaders)
+			return nil, err
+		}
+
+		loaders = append(loaders, altLoaders...)
+	}
+
+	return loaders, nil
+}
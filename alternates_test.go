@@ -0,0 +1,60 @@
+package gitreader
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAlternates(t *testing.T) {
+	dirs, err := readAlternates("fixtures/alternates/base.git/objects")
+	require.NoError(t, err)
+
+	expected := []string{
+		filepath.Join("fixtures", "history.git", "objects"),
+		filepath.Join("fixtures", "alternates", "clone.git", "objects"),
+		"/nonexistent/objects",
+	}
+
+	assert.Equal(t, expected, dirs)
+}
+
+func TestRepoAlternates(t *testing.T) {
+	repo, err := OpenRepo("fixtures/alternates/clone.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	// clone.git, base.git and history.git each add a LooseObject and
+	// history.git adds a pack. The cycle back to clone.git and the
+	// missing store are skipped.
+	assert.Equal(t, 4, len(repo.Loaders))
+
+	// in clone.git
+	id, err := repo.ResolveRef("HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "810f0ee03e4ec35c72524282e1c0dd2b26eaea02", id)
+
+	// in history.git, through base.git
+	id, err = repo.ResolveRef("HEAD~1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8", id)
+
+	blob, err := repo.CatFile("HEAD", "src/main.go")
+	require.NoError(t, err)
+
+	data, err := blob.Bytes()
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "hello, flags")
+
+	// in base.git
+	obj, err := repo.LoadObject("8796eede7ab3529318548837dcdcdafec0edd97a")
+	require.NoError(t, err)
+
+	assert.Equal(t, "blob", obj.Type)
+}
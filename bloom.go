@@ -0,0 +1,191 @@
+package gitreader
+
+import (
+	"math/bits"
+	"strings"
+)
+
+const (
+	_CHUNK_BLOOM_INDEXES = 0x42494458 // BIDX
+	_CHUNK_BLOOM_DATA    = 0x42444154 // BDAT
+)
+
+// The seeds git hashes paths with to find the bits of a changed-path
+// Bloom filter
+const (
+	bloomSeed1 = 0x293ae76f
+	bloomSeed2 = 0x7e646e2c
+)
+
+// How a layer of a commit-graph built its Bloom filters
+type bloomSettings struct {
+	hashVersion  uint32
+	numHashes    uint32
+	bitsPerEntry uint32
+}
+
+// Read the Bloom filter chunks of a commit-graph layer. A layer
+// written without them, or with a hash we don't know, has no filters.
+func (l *graphLayer) loadBloom(chunks map[uint32][]byte) {
+	index := chunks[_CHUNK_BLOOM_INDEXES]
+	data := chunks[_CHUNK_BLOOM_DATA]
+
+	if len(index) < 4*int(l.count) || len(data) < 12 {
+		return
+	}
+
+	settings := bloomSettings{
+		hashVersion:  order.Uint32(data),
+		numHashes:    order.Uint32(data[4:]),
+		bitsPerEntry: order.Uint32(data[8:]),
+	}
+
+	if settings.hashVersion != 1 && settings.hashVersion != 2 {
+		return
+	}
+
+	l.bloom = &settings
+	l.bloomIndex = index
+	l.bloomData = data[12:]
+}
+
+// Return the Bloom filter of the commit at position n of the layer,
+// or nil if it doesn't have a usable one
+func (l *graphLayer) bloomFilter(n uint32) []byte {
+	if l.bloom == nil {
+		return nil
+	}
+
+	var start uint32
+	if n > 0 {
+		start = order.Uint32(l.bloomIndex[4*(n-1):])
+	}
+
+	end := order.Uint32(l.bloomIndex[4*n:])
+
+	if start >= end || end > uint32(len(l.bloomData)) {
+		return nil
+	}
+
+	return l.bloomData[start:end]
+}
+
+// Report whether the commit id may have changed path compared to its
+// first parent, according to the changed-path Bloom filter the graph
+// keeps for it. A false answer is certain but a true one may be
+// wrong. ok is false if the commit doesn't have a filter, in which
+// case its trees have to be compared instead.
+func (g *CommitGraph) MaybeChangedPath(id, path string) (maybe, ok bool) {
+	pos, found := g.find(strings.ToLower(id))
+	if !found {
+		return false, false
+	}
+
+	layer, n := g.layerAt(pos)
+
+	filter := layer.bloomFilter(n)
+	if filter == nil {
+		return false, false
+	}
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return true, true
+	}
+
+	// The filter holds each changed path along with all of its
+	// leading directories, so every one of them must be present
+	for {
+		if !bloomContains(filter, layer.bloom, path) {
+			return false, true
+		}
+
+		i := strings.LastIndexByte(path, '/')
+		if i == -1 {
+			return true, true
+		}
+
+		path = path[:i]
+	}
+}
+
+func bloomContains(filter []byte, settings *bloomSettings, key string) bool {
+	hash1 := murmur3(settings.hashVersion, bloomSeed1, key)
+	hash2 := murmur3(settings.hashVersion, bloomSeed2, key)
+
+	size := uint64(len(filter)) * 8
+
+	for i := uint32(0); i < settings.numHashes; i++ {
+		pos := uint64(hash1+i*hash2) % size
+
+		if filter[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The 32-bit murmur3 hash, as git computes it. Version 1 filters were
+// written by a version of git that sign extended bytes above 0x7f, so
+// for those the bug is kept.
+func murmur3(version, seed uint32, key string) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	byteAt := func(i int) uint32 {
+		if version == 1 {
+			return uint32(int32(int8(key[i])))
+		}
+
+		return uint32(key[i])
+	}
+
+	h := seed
+
+	blocks := len(key) / 4
+
+	for i := 0; i < blocks; i++ {
+		k := byteAt(4*i) | byteAt(4*i+1)<<8 | byteAt(4*i+2)<<16 | byteAt(4*i+3)<<24
+
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := 4 * blocks
+
+	var k uint32
+
+	switch len(key) & 3 {
+	case 3:
+		k ^= byteAt(tail+2) << 16
+		fallthrough
+	case 2:
+		k ^= byteAt(tail+1) << 8
+		fallthrough
+	case 1:
+		k ^= byteAt(tail)
+
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+	}
+
+	h ^= uint32(len(key))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
@@ -0,0 +1,69 @@
+package gitreader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaybeChangedPath(t *testing.T) {
+	graph, err := LoadCommitGraph("fixtures/history.git/objects")
+	require.NoError(t, err)
+
+	defer graph.Close()
+
+	// topic-a: add a
+	topicA := "58093088d2e26942d54605d42502d23d24e3fa21"
+
+	maybe, ok := graph.MaybeChangedPath(topicA, "a.txt")
+	require.True(t, ok)
+	assert.True(t, maybe)
+
+	for _, path := range []string{"b.txt", "src/main.go", "docs", "a.txt/nope"} {
+		maybe, ok = graph.MaybeChangedPath(topicA, path)
+		require.True(t, ok)
+		assert.False(t, maybe, path)
+	}
+
+	// rename util to helpers
+	maybe, ok = graph.MaybeChangedPath("004e64b9cd0591af35345b0e27a2dfb7356aece1", "/src/helpers.go")
+	require.True(t, ok)
+	assert.True(t, maybe)
+
+	_, ok = graph.MaybeChangedPath("201a611d1cf673716b333d47712d7f988f3cf7e4", "a.txt")
+	assert.False(t, ok)
+
+	// The split graph was written without filters
+	chain, err := LoadCommitGraph("fixtures/crisscross.git/objects")
+	require.NoError(t, err)
+
+	defer chain.Close()
+
+	_, ok = chain.MaybeChangedPath("b1f82142bb7b2098fb67b4c45185e1d685f04c8e", "a.txt")
+	assert.False(t, ok)
+}
+
+func TestBloomHighBitPaths(t *testing.T) {
+	graph, err := LoadCommitGraph("fixtures/bloom.git/objects")
+	require.NoError(t, err)
+
+	defer graph.Close()
+
+	// git writes version 1 filters, which hash bytes above 0x7f as if
+	// they were negative
+	require.Equal(t, uint32(1), graph.layers[0].bloom.hashVersion)
+
+	for _, path := range []string{"é", "éé", "aé", "abcdé", "éabc", "aaaaé", "aaaaaé", "ééé"} {
+		maybe, ok := graph.MaybeChangedPath("6ad990874ddf7a6a76ff41831cba0f1f579d9695", path)
+		require.True(t, ok)
+		assert.True(t, maybe, path)
+	}
+}
+
+func TestMurmur3(t *testing.T) {
+	assert.Equal(t, uint32(0), murmur3(2, 0, ""))
+	assert.Equal(t, uint32(0x2e4ff723), murmur3(2, 0, "The quick brown fox jumps over the lazy dog"))
+	assert.Equal(t, murmur3(1, bloomSeed1, "src/main.go"), murmur3(2, bloomSeed1, "src/main.go"))
+	assert.NotEqual(t, murmur3(1, bloomSeed1, "aé"), murmur3(2, bloomSeed1, "aé"))
+}
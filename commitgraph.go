@@ -0,0 +1,413 @@
+package gitreader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+var ErrBadCommitGraph = errors.New("bad commit-graph format")
+
+const commitGraphHeader = "CGPH"
+
+const (
+	_CHUNK_COMMIT_DATA         = 0x43444154 // CDAT
+	_CHUNK_EXTRA_EDGES         = 0x45444745 // EDGE
+	_CHUNK_GENERATION_DATA     = 0x47444132 // GDA2
+	_CHUNK_GENERATION_OVERFLOW = 0x47444f32 // GDO2
+	_CHUNK_BASE_GRAPHS         = 0x42415345 // BASE
+)
+
+const (
+	graphParentNone = 0x70000000
+
+	// Set on the second parent when the parents are in the extra
+	// edges chunk, and on the last of them there
+	graphExtraEdges = 0x80000000
+
+	// Set on a generation offset kept in the overflow chunk
+	graphGenerationOverflow = 0x80000000
+)
+
+// What the commit-graph records about a commit
+type GraphCommit struct {
+	Tree    string
+	Parents []string
+
+	// The committer date, without its time zone
+	Time time.Time
+
+	// Larger than the generation of any of the commit's ancestors.
+	// This is the corrected commit date if the graph has one, and
+	// otherwise the commit's distance from a root commit. Zero if
+	// the graph was written without generation numbers.
+	Generation uint64
+}
+
+// Reads objects/info/commit-graph, or a chain of split graphs in
+// objects/info/commit-graphs, which hold the parents, tree and date
+// of each commit so that history can be walked without inflating
+// the commits themselves.
+type CommitGraph struct {
+	format *ObjectFormat
+	layers []*graphLayer
+	count  uint32
+
+	// Whether every layer has corrected commit dates
+	corrected bool
+}
+
+// One file of a commit-graph. Commits are numbered across the whole
+// chain, with the commits of the layers below this one first.
+type graphLayer struct {
+	path string
+	file *os.File
+	data mmap.MMap
+
+	base  uint32
+	count uint32
+
+	fanout     []byte
+	oids       []byte
+	commits    []byte
+	edges      []byte
+	generation []byte
+	overflow   []byte
+
+	// The changed-path Bloom filters, if the layer has them
+	bloom      *bloomSettings
+	bloomIndex []byte
+	bloomData  []byte
+}
+
+// Load the commit-graph of the objects directory dir. Like git, a
+// single info/commit-graph file is used in preference to a chain.
+func LoadCommitGraph(dir string) (*CommitGraph, error) {
+	g := &CommitGraph{}
+
+	err := g.load(dir)
+	if err != nil {
+		g.Close()
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func (g *CommitGraph) load(dir string) error {
+	err := g.addLayer(filepath.Join(dir, "info", "commit-graph"), nil)
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	graphs := filepath.Join(dir, "info", "commit-graphs")
+
+	chain, err := ioutil.ReadFile(filepath.Join(graphs, "commit-graph-chain"))
+	if err != nil {
+		return err
+	}
+
+	var hashes []string
+
+	for _, line := range strings.Split(string(chain), "\n") {
+		hash := strings.TrimSpace(line)
+		if hash == "" {
+			continue
+		}
+
+		err := g.addLayer(filepath.Join(graphs, "graph-"+hash+".graph"), hashes)
+		if err != nil {
+			return err
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	if len(g.layers) == 0 {
+		return ErrBadCommitGraph
+	}
+
+	return nil
+}
+
+// Open the graph file at path and add it on top of the layers
+// already loaded, whose hashes are bases
+func (g *CommitGraph) addLayer(path string, bases []string) error {
+	layer := &graphLayer{path: path, base: g.count}
+
+	var err error
+	layer.file, err = os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	g.layers = append(g.layers, layer)
+
+	layer.data, err = mmap.Map(layer.file, mmap.RDONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	// signature, version, hash version, chunk count, base count
+	data := layer.data
+	if len(data) < 8 || string([]byte(data[:4])) != commitGraphHeader || data[4] != 1 {
+		return ErrBadCommitGraph
+	}
+
+	var format *ObjectFormat
+
+	switch data[5] {
+	case 1:
+		format = SHA1
+	case 2:
+		format = SHA256
+	default:
+		return ErrBadCommitGraph
+	}
+
+	if g.format != nil && g.format != format {
+		return ErrBadCommitGraph
+	}
+
+	g.format = format
+
+	if int(data[7]) != len(bases) {
+		return ErrBadCommitGraph
+	}
+
+	chunks, err := readChunks(data, 8, int(data[6]))
+	if err != nil {
+		return ErrBadCommitGraph
+	}
+
+	layer.fanout = chunks[_CHUNK_OID_FANOUT]
+	layer.oids = chunks[_CHUNK_OID_LOOKUP]
+	layer.commits = chunks[_CHUNK_COMMIT_DATA]
+	layer.edges = chunks[_CHUNK_EXTRA_EDGES]
+	layer.generation = chunks[_CHUNK_GENERATION_DATA]
+	layer.overflow = chunks[_CHUNK_GENERATION_OVERFLOW]
+
+	if len(layer.fanout) != 1024 {
+		return ErrBadCommitGraph
+	}
+
+	layer.count = order.Uint32(layer.fanout[1020:])
+
+	size := format.Size
+	count := int(layer.count)
+
+	if len(layer.oids) < size*count || len(layer.commits) < (size+16)*count {
+		return ErrBadCommitGraph
+	}
+
+	// Each layer names the files of the layers below it
+	if len(bases) > 0 {
+		var names bytes.Buffer
+		for _, base := range bases {
+			names.WriteString(base)
+		}
+
+		if hex.EncodeToString(chunks[_CHUNK_BASE_GRAPHS]) != names.String() {
+			return ErrBadCommitGraph
+		}
+	}
+
+	layer.loadBloom(chunks)
+
+	hasGeneration := len(layer.generation) >= 4*count
+	if len(g.layers) == 1 {
+		g.corrected = hasGeneration
+	} else {
+		g.corrected = g.corrected && hasGeneration
+	}
+
+	g.count += layer.count
+
+	return nil
+}
+
+func (g *CommitGraph) Close() error {
+	for _, layer := range g.layers {
+		if layer.data != nil {
+			layer.data.Unmap()
+		}
+
+		layer.file.Close()
+	}
+
+	return nil
+}
+
+// The number of commits in the graph
+func (g *CommitGraph) Len() int {
+	return int(g.count)
+}
+
+// Return the layer holding the commit at position pos, and where it
+// is in that layer
+func (g *CommitGraph) layerAt(pos uint32) (*graphLayer, uint32) {
+	for _, layer := range g.layers {
+		if pos < layer.base+layer.count {
+			return layer, pos - layer.base
+		}
+	}
+
+	return nil, 0
+}
+
+func (l *graphLayer) idAt(n uint32, size int) []byte {
+	return l.oids[size*int(n) : size*int(n)+size]
+}
+
+// Find the position of the commit id in the graph
+func (g *CommitGraph) find(id string) (uint32, bool) {
+	idBytes, err := hex.DecodeString(id)
+	if err != nil || len(idBytes) != g.format.Size {
+		return 0, false
+	}
+
+	size := g.format.Size
+
+	for _, layer := range g.layers {
+		ids := idTable{
+			fanout: layer.fanout,
+			idAt:   func(n uint32) []byte { return layer.idAt(n, size) },
+			count:  layer.count,
+		}
+
+		if n, ok := ids.find(idBytes); ok {
+			return layer.base + n, true
+		}
+	}
+
+	return 0, false
+}
+
+// Return what the graph records about the commit id. Returns
+// ErrNotExist if the commit isn't in the graph.
+func (g *CommitGraph) Lookup(id string) (*GraphCommit, error) {
+	pos, ok := g.find(strings.ToLower(id))
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	layer, n := g.layerAt(pos)
+	size := g.format.Size
+
+	entry := layer.commits[(size+16)*int(n):]
+
+	commit := &GraphCommit{Tree: hex.EncodeToString(entry[:size])}
+
+	var parents []uint32
+
+	if first := order.Uint32(entry[size:]); first != graphParentNone {
+		parents = append(parents, first)
+	}
+
+	second := order.Uint32(entry[size+4:])
+
+	switch {
+	case second == graphParentNone:
+	case second&graphExtraEdges == 0:
+		parents = append(parents, second)
+	default:
+		for i := int(second &^ graphExtraEdges); ; i++ {
+			if len(layer.edges) < 4*i+4 {
+				return nil, ErrBadCommitGraph
+			}
+
+			edge := order.Uint32(layer.edges[4*i:])
+			parents = append(parents, edge&^graphExtraEdges)
+
+			if edge&graphExtraEdges != 0 {
+				break
+			}
+		}
+	}
+
+	for _, parent := range parents {
+		parentLayer, pn := g.layerAt(parent)
+		if parentLayer == nil {
+			return nil, ErrBadCommitGraph
+		}
+
+		commit.Parents = append(commit.Parents, hex.EncodeToString(parentLayer.idAt(pn, size)))
+	}
+
+	// The top 30 bits hold the topological level and the low 34 the
+	// commit date
+	high := order.Uint32(entry[size+8:])
+	seconds := int64(high&3)<<32 | int64(order.Uint32(entry[size+12:]))
+
+	commit.Time = time.Unix(seconds, 0)
+	commit.Generation = uint64(high >> 2)
+
+	if g.corrected {
+		offset := uint64(order.Uint32(layer.generation[4*n:]))
+
+		if offset&graphGenerationOverflow != 0 {
+			idx := offset &^ graphGenerationOverflow
+			if uint64(len(layer.overflow)) < 8*idx+8 {
+				return nil, ErrBadCommitGraph
+			}
+
+			offset = order.Uint64(layer.overflow[8*idx:])
+		}
+
+		commit.Generation = uint64(seconds) + offset
+	}
+
+	return commit, nil
+}
+
+// Use the commit-graph in the repo's objects directory, unless
+// core.commitGraph is false. As with git, a graph that can't be read
+// is ignored and commits are read directly instead.
+func (r *Repo) loadCommitGraph() {
+	if enabled, err := r.Config.GetBool("core.commitGraph"); err == nil && !enabled {
+		return
+	}
+
+	graph, err := LoadCommitGraph(filepath.Join(r.commonDir(), "objects"))
+	if err != nil {
+		return
+	}
+
+	if graph.format != r.format() {
+		graph.Close()
+		return
+	}
+
+	r.CommitGraph = graph
+}
+
+// Read what a history walk needs to know about the commit id. The
+// commit-graph is used when it has the commit, otherwise the commit
+// is read and kept.
+func (r *Repo) walkCommit(id string) (*queuedCommit, error) {
+	if r.CommitGraph != nil {
+		if info, err := r.CommitGraph.Lookup(id); err == nil {
+			return &queuedCommit{
+				id:         id,
+				tree:       info.Tree,
+				parents:    info.Parents,
+				when:       info.Time,
+				generation: info.Generation,
+			}, nil
+		}
+	}
+
+	commit, err := r.loadCommit(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newQueuedCommit(id, commit), nil
+}
@@ -0,0 +1,104 @@
+package gitreader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitGraph(t *testing.T) {
+	graph, err := LoadCommitGraph("fixtures/history.git/objects")
+	require.NoError(t, err)
+
+	defer graph.Close()
+
+	assert.Equal(t, 13, graph.Len())
+
+	// An octopus merge keeps its extra parents in the edges chunk
+	commit, err := graph.Lookup("4ec79ca0490495659ae7f0c13604a894977bca62")
+	require.NoError(t, err)
+
+	assert.Equal(t, "201a611d1cf673716b333d47712d7f988f3cf7e4", commit.Tree)
+	assert.Equal(t, []string{
+		"f8ed0f8d65e62019f40b9e74ffb830016bb98088",
+		"58093088d2e26942d54605d42502d23d24e3fa21",
+		"631e210f6c96c52bc169da6cde79eeccf2b25133",
+	}, commit.Parents)
+	assert.Equal(t, int64(1418571780), commit.Time.Unix())
+	assert.Equal(t, uint64(1418571780), commit.Generation)
+
+	commit, err = graph.Lookup("6672ee4b1f141d706319e7dd7c37c869ad9f8659")
+	require.NoError(t, err)
+
+	assert.Equal(t, "4946046201d8747359be4f078c262674bbcebc79", commit.Tree)
+	assert.Empty(t, commit.Parents)
+	assert.Equal(t, uint64(1418542920), commit.Generation)
+
+	_, err = graph.Lookup("201a611d1cf673716b333d47712d7f988f3cf7e4")
+	assert.Equal(t, ErrNotExist, err)
+}
+
+func TestCommitGraphChain(t *testing.T) {
+	graph, err := LoadCommitGraph("fixtures/crisscross.git/objects")
+	require.NoError(t, err)
+
+	defer graph.Close()
+
+	assert.Equal(t, 2, len(graph.layers))
+	assert.Equal(t, 6, graph.Len())
+
+	// x is in the top layer and its parents are in the base
+	commit, err := graph.Lookup("b1f82142bb7b2098fb67b4c45185e1d685f04c8e")
+	require.NoError(t, err)
+
+	assert.Equal(t, "53cbee9efb4abfb41df2b538df60d6d0df8bb38f", commit.Tree)
+	assert.Equal(t, []string{
+		"d59c1bd4bf20b49ee4ddb6b654861b956aeaa73e",
+		"508f40bd627612a8f04d30f4292b223c0286f1d9",
+	}, commit.Parents)
+
+	commit, err = graph.Lookup("d59c1bd4bf20b49ee4ddb6b654861b956aeaa73e")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"5dcb52128fdd502fa53a966d25fc1930bd2c8240"}, commit.Parents)
+	assert.Equal(t, int64(1418546520), commit.Time.Unix())
+}
+
+func TestRepoUsesCommitGraph(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	require.NotNil(t, repo.CommitGraph)
+
+	tags, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer tags.Close()
+
+	assert.Nil(t, tags.CommitGraph)
+
+	// Walks give the same answers with and without the graph
+	walk := func() string {
+		w := repo.NewRevWalk()
+		w.Sort = SortTopo
+		require.NoError(t, w.PushRange("feature...main"))
+
+		return shortWalk(t, w)
+	}
+
+	withGraph := walk()
+
+	ok, err := repo.IsAncestor("topic-a", "topic-b")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = repo.IsAncestor("v0.1", "main")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	repo.CommitGraph.Close()
+	repo.CommitGraph = nil
+
+	assert.Equal(t, withGraph, walk())
+}
@@ -0,0 +1,730 @@
+package gitreader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrNoConfigValue = errors.New("config value not set")
+var ErrBadConfigValue = errors.New("bad config value")
+var ErrIncludeDepth = errors.New("config includes nested too deeply")
+
+// Returned when a config file can't be parsed
+type ConfigSyntaxError struct {
+	File string
+	Line int
+}
+
+func (e *ConfigSyntaxError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("bad config line %d", e.Line)
+	}
+
+	return fmt.Sprintf("bad config line %d in file %s", e.Line, e.File)
+}
+
+// git gives up on includes nested deeper than this
+const maxIncludeDepth = 10
+
+type configEntry struct {
+	section, subsection, key, value string
+
+	// Keys given without an "=" are implicitly true
+	hasValue bool
+}
+
+// The contents of git config files, in the order they were read.
+// Names passed to the getters are in git's "section.key" or
+// "section.subsection.key" form, where the section and key are
+// case-insensitive and the subsection is not.
+type Config struct {
+	entries []configEntry
+}
+
+// Parse a config file from r. Relative include paths can't be
+// resolved and conditional includes never match, so use LoadConfig
+// or Repo.Config to have those followed.
+func ParseConfig(r io.Reader) (*Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+
+	err = (&configLoader{}).parse(cfg, data, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Read the config file at path, following any include.path entries
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+
+	err := (&configLoader{}).load(cfg, path, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Read the repo's config file. includeIf conditions are checked
+// against this repo. If extensions.worktreeConfig is set, the
+// config.worktree file of the current worktree is read after it.
+func (r *Repo) loadConfig() (*Config, error) {
+	l := &configLoader{gitDir: r.Base, branch: r.headBranch()}
+
+	cfg := &Config{}
+
+	err := l.load(cfg, filepath.Join(r.commonDir(), "config"), 0)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if on, _ := cfg.GetBool("extensions.worktreeConfig"); on {
+		err = l.load(cfg, filepath.Join(r.Base, "config.worktree"), 0)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// Return the name of the branch HEAD points to, without refs/heads/.
+// Empty if HEAD is detached.
+func (r *Repo) headBranch() string {
+	data, err := ioutil.ReadFile(filepath.Join(r.Base, "HEAD"))
+	if err != nil {
+		return ""
+	}
+
+	line := strings.TrimSpace(string(data))
+
+	if !strings.HasPrefix(line, "ref:") {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.TrimSpace(line[4:]), "refs/heads/")
+}
+
+// Split a name like remote.origin.url into its parts, normalizing
+// the case of the parts that are case-insensitive
+func splitConfigName(name string) (string, string, string) {
+	first := strings.IndexByte(name, '.')
+	last := strings.LastIndexByte(name, '.')
+
+	if first == -1 {
+		return strings.ToLower(name), "", ""
+	}
+
+	var subsection string
+	if first != last {
+		subsection = name[first+1 : last]
+	}
+
+	return strings.ToLower(name[:first]), subsection, strings.ToLower(name[last+1:])
+}
+
+func (c *Config) lookup(name string) []configEntry {
+	section, subsection, key := splitConfigName(name)
+
+	var found []configEntry
+
+	for _, entry := range c.entries {
+		if entry.section == section && entry.subsection == subsection && entry.key == key {
+			found = append(found, entry)
+		}
+	}
+
+	return found
+}
+
+// Return the value of name. When it is set more than once the last
+// value wins, as it does in git.
+func (c *Config) Get(name string) (string, error) {
+	found := c.lookup(name)
+	if len(found) == 0 {
+		return "", ErrNoConfigValue
+	}
+
+	return found[len(found)-1].value, nil
+}
+
+// Return every value of the multi-valued name, in order
+func (c *Config) GetAll(name string) []string {
+	var values []string
+
+	for _, entry := range c.lookup(name) {
+		values = append(values, entry.value)
+	}
+
+	return values
+}
+
+// Return name as a boolean. Accepts true, yes, on and 1, their
+// opposites, and a key with no value at all, which means true.
+func (c *Config) GetBool(name string) (bool, error) {
+	found := c.lookup(name)
+	if len(found) == 0 {
+		return false, ErrNoConfigValue
+	}
+
+	entry := found[len(found)-1]
+	if !entry.hasValue {
+		return true, nil
+	}
+
+	return parseConfigBool(entry.value)
+}
+
+func parseConfigBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+
+	return false, ErrBadConfigValue
+}
+
+// Return name as an integer. A k, m or g suffix multiplies the
+// value by 1024, 1024^2 or 1024^3.
+func (c *Config) GetInt(name string) (int64, error) {
+	value, err := c.Get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseConfigInt(value)
+}
+
+func parseConfigInt(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, ErrBadConfigValue
+	}
+
+	var unit int64 = 1
+
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		unit = 1 << 10
+	case 'm', 'M':
+		unit = 1 << 20
+	case 'g', 'G':
+		unit = 1 << 30
+	}
+
+	if unit != 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, ErrBadConfigValue
+	}
+
+	if n > 0 && n > (1<<63-1)/unit || n < 0 && n < (-1<<63)/unit {
+		return 0, ErrBadConfigValue
+	}
+
+	return n * unit, nil
+}
+
+// Return the subsections of section that have been set, in the
+// order they first appear. For instance, Subsections("remote")
+// returns the names of the configured remotes.
+func (c *Config) Subsections(section string) []string {
+	section = strings.ToLower(section)
+
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, entry := range c.entries {
+		if entry.section == section && entry.subsection != "" && !seen[entry.subsection] {
+			seen[entry.subsection] = true
+			names = append(names, entry.subsection)
+		}
+	}
+
+	return names
+}
+
+// Reads config files, following includes. gitDir and branch are
+// used to evaluate includeIf conditions, and are empty when there's
+// no repo to check against.
+type configLoader struct {
+	gitDir, branch string
+}
+
+func (l *configLoader) load(cfg *Config, path string, depth int) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return l.parse(cfg, data, path, depth)
+}
+
+// Handle an include.path or includeIf.<condition>.path entry
+// found in file
+func (l *configLoader) include(cfg *Config, entry configEntry, file string, depth int) error {
+	if entry.key != "path" || !entry.hasValue {
+		return nil
+	}
+
+	switch entry.section {
+	case "include":
+		if entry.subsection != "" {
+			return nil
+		}
+	case "includeif":
+		if !l.matchCondition(entry.subsection, file) {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	path := expandHome(entry.value)
+
+	if !filepath.IsAbs(path) {
+		// Relative includes only make sense relative to a file
+		if file == "" {
+			return nil
+		}
+
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+
+	if depth+1 > maxIncludeDepth {
+		return ErrIncludeDepth
+	}
+
+	err := l.load(cfg, path, depth+1)
+
+	// git quietly skips includes that don't exist
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (l *configLoader) matchCondition(cond, file string) bool {
+	switch {
+	case strings.HasPrefix(cond, "gitdir:"):
+		return l.matchGitDir(cond[7:], false, file)
+	case strings.HasPrefix(cond, "gitdir/i:"):
+		return l.matchGitDir(cond[9:], true, file)
+	case strings.HasPrefix(cond, "onbranch:"):
+		if l.branch == "" {
+			return false
+		}
+
+		pattern := cond[9:]
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+
+		return globMatch(pattern, l.branch, false)
+	}
+
+	return false
+}
+
+func (l *configLoader) matchGitDir(pattern string, fold bool, file string) bool {
+	if l.gitDir == "" {
+		return false
+	}
+
+	pattern = expandHome(pattern)
+
+	switch {
+	case strings.HasPrefix(pattern, "./"):
+		if file == "" {
+			return false
+		}
+
+		pattern = filepath.ToSlash(filepath.Dir(file)) + pattern[1:]
+	case !filepath.IsAbs(pattern):
+		pattern = "**/" + pattern
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	gitDir, err := filepath.Abs(l.gitDir)
+	if err != nil {
+		return false
+	}
+
+	if globMatch(pattern, filepath.ToSlash(gitDir), fold) {
+		return true
+	}
+
+	// Like git, also try the path with symlinks resolved
+	real, err := filepath.EvalSymlinks(gitDir)
+	if err != nil || real == gitDir {
+		return false
+	}
+
+	return globMatch(pattern, filepath.ToSlash(real), fold)
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
+
+// Match name against a wildcard pattern in which * and ? don't match
+// a slash but ** matches across directories
+func globMatch(pattern, name string, fold bool) bool {
+	var re strings.Builder
+
+	if fold {
+		re.WriteString("(?i)")
+	}
+
+	re.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[' && strings.IndexByte(pattern[i:], ']') > 1:
+			end := i + strings.IndexByte(pattern[i:], ']')
+			class := pattern[i+1 : end]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+
+			re.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i = end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	re.WriteString("$")
+
+	matched, err := regexp.MatchString(re.String(), name)
+	return err == nil && matched
+}
+
+// Parse the config in data, adding its entries to cfg and following
+// includes as they're found. file is where data was read from.
+func (l *configLoader) parse(cfg *Config, data []byte, file string, depth int) error {
+	p := &configParser{data: data, line: 1}
+
+	bad := func() error {
+		return &ConfigSyntaxError{file, p.line}
+	}
+
+	var section, subsection string
+
+	for {
+		p.skipSpace(true)
+
+		c, ok := p.peek()
+		if !ok {
+			return nil
+		}
+
+		switch {
+		case c == '#' || c == ';':
+			p.skipLine()
+		case c == '[':
+			var ok bool
+			section, subsection, ok = p.header()
+			if !ok {
+				return bad()
+			}
+		case isConfigKeyStart(c):
+			if section == "" {
+				return bad()
+			}
+
+			entry := configEntry{section: section, subsection: subsection, key: p.key()}
+
+			p.skipSpace(false)
+
+			c, ok := p.peek()
+
+			switch {
+			case !ok || c == '\n' || c == '#' || c == ';':
+			case c == '=':
+				p.pos++
+
+				value, ok := p.value()
+				if !ok {
+					return bad()
+				}
+
+				entry.value = value
+				entry.hasValue = true
+			default:
+				return bad()
+			}
+
+			cfg.entries = append(cfg.entries, entry)
+
+			err := l.include(cfg, entry, file, depth)
+			if err != nil {
+				return err
+			}
+		default:
+			return bad()
+		}
+	}
+}
+
+type configParser struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (p *configParser) peek() (byte, bool) {
+	if p.pos >= len(p.data) {
+		return 0, false
+	}
+
+	return p.data[p.pos], true
+}
+
+// Skip spaces and tabs, and newlines too if lines is set
+func (p *configParser) skipSpace(lines bool) {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r':
+		case '\n':
+			if !lines {
+				return
+			}
+
+			p.line++
+		default:
+			return
+		}
+
+		p.pos++
+	}
+}
+
+func (p *configParser) skipLine() {
+	for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+func isConfigKeyStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isConfigKeyChar(c byte) bool {
+	return isConfigKeyStart(c) || c >= '0' && c <= '9' || c == '-'
+}
+
+func (p *configParser) key() string {
+	start := p.pos
+
+	for p.pos < len(p.data) && isConfigKeyChar(p.data[p.pos]) {
+		p.pos++
+	}
+
+	return strings.ToLower(string(p.data[start:p.pos]))
+}
+
+// Parse a section header like [core], [remote "origin"] or the
+// older [branch.master] form
+func (p *configParser) header() (string, string, bool) {
+	p.pos++
+
+	start := p.pos
+	for p.pos < len(p.data) && (isConfigKeyChar(p.data[p.pos]) || p.data[p.pos] == '.') {
+		p.pos++
+	}
+
+	name := string(p.data[start:p.pos])
+	if name == "" {
+		return "", "", false
+	}
+
+	c, ok := p.peek()
+	if !ok {
+		return "", "", false
+	}
+
+	if c == ']' {
+		p.pos++
+
+		// The old syntax lower cases the subsection
+		if dot := strings.IndexByte(name, '.'); dot != -1 {
+			return strings.ToLower(name[:dot]), strings.ToLower(name[dot+1:]), true
+		}
+
+		return strings.ToLower(name), "", true
+	}
+
+	if c != ' ' && c != '\t' || strings.IndexByte(name, '.') != -1 {
+		return "", "", false
+	}
+
+	p.skipSpace(false)
+
+	if c, ok := p.peek(); !ok || c != '"' {
+		return "", "", false
+	}
+
+	p.pos++
+
+	var sub bytes.Buffer
+
+	for {
+		c, ok := p.peek()
+		if !ok || c == '\n' {
+			return "", "", false
+		}
+
+		p.pos++
+
+		if c == '"' {
+			break
+		}
+
+		if c == '\\' {
+			c, ok = p.peek()
+			if !ok || c == '\n' {
+				return "", "", false
+			}
+
+			p.pos++
+		}
+
+		sub.WriteByte(c)
+	}
+
+	if c, ok := p.peek(); !ok || c != ']' {
+		return "", "", false
+	}
+
+	p.pos++
+
+	return strings.ToLower(name), sub.String(), true
+}
+
+// Parse a value up to the end of the line. Whitespace around the
+// value is dropped unless quoted, and a backslash at the end of a
+// line continues the value on the next.
+func (p *configParser) value() (string, bool) {
+	var (
+		buf    bytes.Buffer
+		quoted bool
+		spaces int
+	)
+
+	p.skipSpace(false)
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+
+		if c == '\n' {
+			if quoted {
+				return "", false
+			}
+
+			break
+		}
+
+		p.pos++
+
+		if !quoted && (c == ' ' || c == '\t' || c == '\r') {
+			spaces++
+			continue
+		}
+
+		if !quoted && (c == '#' || c == ';') {
+			p.skipLine()
+			break
+		}
+
+		if spaces > 0 {
+			buf.WriteString(strings.Repeat(" ", spaces))
+			spaces = 0
+		}
+
+		switch c {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if p.pos >= len(p.data) {
+				return "", false
+			}
+
+			next := p.data[p.pos]
+			p.pos++
+
+			switch next {
+			case '\n':
+				p.line++
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				if buf.Len() > 0 {
+					buf.Truncate(buf.Len() - 1)
+				}
+			case '\\', '"':
+				buf.WriteByte(next)
+			default:
+				return "", false
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	if quoted {
+		return "", false
+	}
+
+	return buf.String(), true
+}
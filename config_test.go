@@ -0,0 +1,187 @@
+package gitreader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleConfig = `# comment
+[core]
+	repositoryformatversion = 0
+	FileMode = true ; trailing comment
+	autocrlf
+	packedGitLimit = 2k
+	windowSize = -1g
+[remote "origin"]
+	url = https://example.com/repo.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/notes/*:refs/notes/*
+[remote "Upper \"quoted\""]
+	url = "  spaced # not a comment  "
+[branch.Main]
+	remote = origin
+[alias]
+	lg = log --graph \
+	  --oneline
+	say = "echo \"hi\"\tthere\n"
+`
+
+func TestConfigGet(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(sampleConfig))
+	require.NoError(t, err)
+
+	val, err := cfg.Get("core.repositoryformatversion")
+	require.NoError(t, err)
+	assert.Equal(t, "0", val)
+
+	val, err = cfg.Get("CORE.filemode")
+	require.NoError(t, err)
+	assert.Equal(t, "true", val)
+
+	val, err = cfg.Get("remote.origin.fetch")
+	require.NoError(t, err)
+	assert.Equal(t, "+refs/notes/*:refs/notes/*", val)
+
+	val, err = cfg.Get(`remote.Upper "quoted".url`)
+	require.NoError(t, err)
+	assert.Equal(t, "  spaced # not a comment  ", val)
+
+	val, err = cfg.Get("branch.main.remote")
+	require.NoError(t, err)
+	assert.Equal(t, "origin", val)
+
+	val, err = cfg.Get("alias.lg")
+	require.NoError(t, err)
+	assert.Equal(t, "log --graph    --oneline", val)
+
+	val, err = cfg.Get("alias.say")
+	require.NoError(t, err)
+	assert.Equal(t, "echo \"hi\"\tthere\n", val)
+
+	_, err = cfg.Get("remote.ORIGIN.url")
+	assert.Equal(t, ErrNoConfigValue, err)
+
+	assert.Equal(t, []string{
+		"+refs/heads/*:refs/remotes/origin/*",
+		"+refs/notes/*:refs/notes/*",
+	}, cfg.GetAll("remote.origin.fetch"))
+
+	assert.Equal(t, []string{"origin", `Upper "quoted"`}, cfg.Subsections("remote"))
+}
+
+func TestConfigTypedValues(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(sampleConfig))
+	require.NoError(t, err)
+
+	on, err := cfg.GetBool("core.filemode")
+	require.NoError(t, err)
+	assert.True(t, on)
+
+	on, err = cfg.GetBool("core.autocrlf")
+	require.NoError(t, err)
+	assert.True(t, on)
+
+	_, err = cfg.GetBool("remote.origin.url")
+	assert.Equal(t, ErrBadConfigValue, err)
+
+	n, err := cfg.GetInt("core.packedGitLimit")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2048), n)
+
+	n, err = cfg.GetInt("core.windowSize")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1<<30), n)
+
+	_, err = cfg.GetInt("core.filemode")
+	assert.Equal(t, ErrBadConfigValue, err)
+
+	_, err = cfg.GetInt("core.missing")
+	assert.Equal(t, ErrNoConfigValue, err)
+}
+
+func TestConfigSyntaxError(t *testing.T) {
+	for _, bad := range []string{
+		"key = outside a section\n",
+		"[core\n",
+		"[core]\n\tbad key = 1\n",
+		"[core]\n\tkey = \"unterminated\n",
+		"[core]\n\tkey = bad \\q escape\n",
+	} {
+		_, err := ParseConfig(strings.NewReader("# ok\n" + bad))
+		if assert.IsType(t, &ConfigSyntaxError{}, err, bad) {
+			assert.Equal(t, strings.Count(bad, "\n")+1, err.(*ConfigSyntaxError).Line, bad)
+		}
+	}
+}
+
+func TestConfigIncludes(t *testing.T) {
+	l := &configLoader{gitDir: "fixtures/history.git", branch: "feature/x"}
+
+	cfg := &Config{}
+
+	err := l.load(cfg, "fixtures/config/main", 0)
+	require.NoError(t, err)
+
+	// extra is included after core.compression is first set
+	n, err := cfg.GetInt("core.compression")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = cfg.GetInt("core.bigFileThreshold")
+	require.NoError(t, err)
+	assert.Equal(t, int64(512<<20), n)
+
+	val, err := cfg.Get("remote.origin.url")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/one.git", val)
+
+	val, err = cfg.Get("user.name")
+	require.NoError(t, err)
+	assert.Equal(t, "History", val)
+
+	val, err = cfg.Get("user.email")
+	require.NoError(t, err)
+	assert.Equal(t, "feature@example.com", val)
+}
+
+func TestConfigIncludeConditionsNeedRepo(t *testing.T) {
+	cfg, err := LoadConfig("fixtures/config/main")
+	require.NoError(t, err)
+
+	_, err = cfg.Get("remote.origin.url")
+	assert.NoError(t, err)
+
+	_, err = cfg.Get("user.name")
+	assert.Equal(t, ErrNoConfigValue, err)
+
+	_, err = cfg.Get("user.email")
+	assert.Equal(t, ErrNoConfigValue, err)
+}
+
+func TestConfigIncludeLoop(t *testing.T) {
+	_, err := LoadConfig("fixtures/config/loop")
+	assert.Equal(t, ErrIncludeDepth, err)
+}
+
+func TestGlobMatch(t *testing.T) {
+	assert.True(t, globMatch("**/history.git", "/src/fixtures/history.git", false))
+	assert.True(t, globMatch("/src/**", "/src/a/b/.git", false))
+	assert.True(t, globMatch("/src/*/.git", "/src/a/.git", false))
+	assert.False(t, globMatch("/src/*/.git", "/src/a/b/.git", false))
+	assert.True(t, globMatch("/SRC/[ab]/.git", "/src/a/.git", true))
+	assert.False(t, globMatch("/SRC/[ab]/.git", "/src/a/.git", false))
+}
+
+func TestRepoConfig(t *testing.T) {
+	repo, err := OpenRepo("fixtures/history.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	bare, err := repo.Config.GetBool("core.bare")
+	require.NoError(t, err)
+	assert.True(t, bare)
+}
@@ -0,0 +1,949 @@
+package gitreader
+
+// The algorithm used to match up the lines of two files
+type DiffAlgorithm int
+
+const (
+	// The classic minimal diff, git's default
+	DiffMyers DiffAlgorithm = iota
+
+	// Match lines that appear once in each file first, then diff the
+	// lines between them, like git diff --patience
+	DiffPatience
+
+	// Like patience, but anchored on the rarest lines rather than only
+	// unique ones, like git diff --histogram
+	DiffHistogram
+)
+
+// The limits git's xdiff tunes its diffs with, so that ours come out
+// the same
+const (
+	// Lines with at least this many matches on the other side may be
+	// left out of the Myers diff
+	myersMaxEqualLimit = 1024
+
+	// How far to look either side of such a line to decide
+	myersScanWindow = 100
+
+	// How many of the lines around it can be common ones
+	myersKeepRun = 4
+
+	// Once this costly, a Myers diff settles for a good enough split
+	myersMinCost = 256
+
+	// A run of this many matching lines counts as a good split
+	myersSnake = 20
+
+	// The cost after which good enough splits are looked for
+	myersHeuristicCost = 256
+
+	myersHeuristicFactor = 4
+
+	// Lines occurring more often than this in a region aren't used as
+	// anchors by the histogram diff
+	histogramMaxChain = 64
+)
+
+const maxInt = int(^uint(0) >> 1)
+
+// Works out which lines of a and b aren't part of their common
+// subsequence. Lines are numbered so they can be compared cheaply.
+type lineDiffer struct {
+	a, b               []int
+	aChanged, bChanged []bool
+	algorithm          DiffAlgorithm
+}
+
+func newLineDiffer(a, b []string, algorithm DiffAlgorithm) *lineDiffer {
+	d := &lineDiffer{
+		a:         make([]int, len(a)),
+		b:         make([]int, len(b)),
+		aChanged:  make([]bool, len(a)),
+		bChanged:  make([]bool, len(b)),
+		algorithm: algorithm,
+	}
+
+	numbers := make(map[string]int)
+
+	number := func(line string) int {
+		n, ok := numbers[line]
+		if !ok {
+			n = len(numbers)
+			numbers[line] = n
+		}
+
+		return n
+	}
+
+	for i, line := range a {
+		d.a[i] = number(line)
+	}
+
+	for i, line := range b {
+		d.b[i] = number(line)
+	}
+
+	return d
+}
+
+func (d *lineDiffer) run() {
+	switch d.algorithm {
+	case DiffPatience:
+		d.patience(0, len(d.a), 0, len(d.b))
+	case DiffHistogram:
+		d.histogram(0, len(d.a), 0, len(d.b))
+	default:
+		d.myers(0, len(d.a), 0, len(d.b))
+	}
+
+	compactChanges(d.a, d.aChanged, d.bChanged)
+	compactChanges(d.b, d.bChanged, d.aChanged)
+}
+
+func (d *lineDiffer) mark(aLo, aHi, bLo, bHi int) {
+	for i := aLo; i < aHi; i++ {
+		d.aChanged[i] = true
+	}
+
+	for i := bLo; i < bHi; i++ {
+		d.bChanged[i] = true
+	}
+}
+
+// Diff the ranges with Myers' algorithm the way xdiff does. Lines the
+// ranges start and end with in common are dropped, as are lines that
+// can't match anything on the other side, then what's left is split
+// in the middle of a shortest edit path and each half diffed in turn.
+func (d *lineDiffer) myers(aLo, aHi, bLo, bHi int) {
+	aCounts := make(map[int]int)
+	for _, line := range d.a[aLo:aHi] {
+		aCounts[line]++
+	}
+
+	bCounts := make(map[int]int)
+	for _, line := range d.b[bLo:bHi] {
+		bCounts[line]++
+	}
+
+	common := aHi - aLo
+	if bHi-bLo < common {
+		common = bHi - bLo
+	}
+
+	start := 0
+	for start < common && d.a[aLo+start] == d.b[bLo+start] {
+		start++
+	}
+
+	end := 0
+	for end < common-start && d.a[aHi-1-end] == d.b[bHi-1-end] {
+		end++
+	}
+
+	m := &myersRun{
+		d: d,
+		a: keepLines(d.a, aLo+start, aHi-end, aHi-aLo, bCounts, d.aChanged),
+		b: keepLines(d.b, bLo+start, bHi-end, bHi-bLo, aCounts, d.bChanged),
+	}
+
+	diagonals := len(m.a) + len(m.b) + 3
+
+	m.offset = len(m.b) + 1
+	m.forward = make([]int, diagonals)
+	m.backward = make([]int, diagonals)
+
+	m.maxCost = bogoSqrt(diagonals)
+	if m.maxCost < myersMinCost {
+		m.maxCost = myersMinCost
+	}
+
+	m.compare(0, len(m.a), 0, len(m.b), false)
+}
+
+// Return the indexes of lines[lo:hi] worth diffing, marking the rest
+// changed. A line is left out if other has no matches for it, or many
+// matches and it sits among lines that have none.
+func keepLines(lines []int, lo, hi, total int, other map[int]int, changed []bool) []int {
+	limit := bogoSqrt(total)
+	if limit > myersMaxEqualLimit {
+		limit = myersMaxEqualLimit
+	}
+
+	// 0 for no matches, 1 for some and 2 for many
+	matches := make([]byte, hi-lo)
+
+	for i := range matches {
+		switch n := other[lines[lo+i]]; {
+		case n == 0:
+			matches[i] = 0
+		case n >= limit:
+			matches[i] = 2
+		default:
+			matches[i] = 1
+		}
+	}
+
+	var kept []int
+
+	for i, m := range matches {
+		if m == 1 || (m == 2 && !amongUnmatched(matches, i)) {
+			kept = append(kept, lo+i)
+		} else {
+			changed[lo+i] = true
+		}
+	}
+
+	return kept
+}
+
+// Report whether the many times matched line i is surrounded by lines
+// with no matches, as xdiff's xdl_clean_mmatch does
+func amongUnmatched(matches []byte, i int) bool {
+	s, e := 0, len(matches)-1
+	if i-s > myersScanWindow {
+		s = i - myersScanWindow
+	}
+
+	if e-i > myersScanWindow {
+		e = i + myersScanWindow
+	}
+
+	var before, beforeMany int
+
+	for r := 1; i-r >= s; r++ {
+		if matches[i-r] == 0 {
+			before++
+		} else if matches[i-r] == 2 {
+			beforeMany++
+		} else {
+			break
+		}
+	}
+
+	if before == 0 {
+		return false
+	}
+
+	var after, afterMany int
+
+	for r := 1; i+r <= e; r++ {
+		if matches[i+r] == 0 {
+			after++
+		} else if matches[i+r] == 2 {
+			afterMany++
+		} else {
+			break
+		}
+	}
+
+	if after == 0 {
+		return false
+	}
+
+	unmatched := before + after
+	many := beforeMany + afterMany + 2
+
+	return many*myersKeepRun < many+unmatched
+}
+
+// A rough square root, as xdiff uses to size its limits
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+
+	return i
+}
+
+// One Myers diff over the lines of a and b picked by keepLines. The
+// forward and backward searches keep how far along a they've reached
+// on each diagonal, offset so the diagonals can be negative.
+type myersRun struct {
+	d *lineDiffer
+
+	a, b []int
+
+	forward, backward []int
+	offset            int
+
+	maxCost int
+}
+
+func (m *myersRun) lineA(i int) int {
+	return m.d.a[m.a[i]]
+}
+
+func (m *myersRun) lineB(i int) int {
+	return m.d.b[m.b[i]]
+}
+
+func (m *myersRun) compare(off1, lim1, off2, lim2 int, needMin bool) {
+	for off1 < lim1 && off2 < lim2 && m.lineA(off1) == m.lineB(off2) {
+		off1++
+		off2++
+	}
+
+	for off1 < lim1 && off2 < lim2 && m.lineA(lim1-1) == m.lineB(lim2-1) {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			m.d.bChanged[m.b[off2]] = true
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			m.d.aChanged[m.a[off1]] = true
+		}
+	default:
+		i1, i2, minLo, minHi := m.split(off1, lim1, off2, lim2, needMin)
+
+		m.compare(off1, i1, off2, i2, minLo)
+		m.compare(i1, lim1, i2, lim2, minHi)
+	}
+}
+
+// Find where to split the ranges by searching forwards from their
+// start and backwards from their end until the searches meet. Unless
+// needMin is set, a costly search settles for a point on a long run of
+// matches, or the furthest either search got. Also returns whether
+// each half needs a minimal diff.
+func (m *myersRun) split(off1, lim1, off2, lim2 int, needMin bool) (int, int, bool, bool) {
+	kvdf := func(d int) *int { return &m.forward[m.offset+d] }
+	kvdb := func(d int) *int { return &m.backward[m.offset+d] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kvdf(fmid) = off1
+	*kvdb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		// Widen the diagonals searched by one each way, unless that
+		// leaves the box
+		if fmin > dmin {
+			fmin--
+			*kvdf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+
+		if fmax < dmax {
+			fmax++
+			*kvdf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kvdf(d - 1) >= *kvdf(d + 1) {
+				i1 = *kvdf(d - 1) + 1
+			} else {
+				i1 = *kvdf(d + 1)
+			}
+
+			prev1 := i1
+			i2 := i1 - d
+
+			for i1 < lim1 && i2 < lim2 && m.lineA(i1) == m.lineB(i2) {
+				i1++
+				i2++
+			}
+
+			if i1-prev1 > myersSnake {
+				gotSnake = true
+			}
+
+			*kvdf(d) = i1
+
+			if odd && bmin <= d && d <= bmax && *kvdb(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			*kvdb(bmin - 1) = maxInt
+		} else {
+			bmin++
+		}
+
+		if bmax < dmax {
+			bmax++
+			*kvdb(bmax + 1) = maxInt
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kvdb(d - 1) < *kvdb(d + 1) {
+				i1 = *kvdb(d - 1)
+			} else {
+				i1 = *kvdb(d + 1) - 1
+			}
+
+			prev1 := i1
+			i2 := i1 - d
+
+			for i1 > off1 && i2 > off2 && m.lineA(i1-1) == m.lineB(i2-1) {
+				i1--
+				i2--
+			}
+
+			if prev1-i1 > myersSnake {
+				gotSnake = true
+			}
+
+			*kvdb(d) = i1
+
+			if !odd && fmin <= d && d <= fmax && i1 <= *kvdf(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// Take a diagonal that has come a long way along a long run of
+		// matches
+		if gotSnake && ec > myersHeuristicCost {
+			best, split1, split2 := 0, 0, 0
+
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+
+				i1 := *kvdf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+
+				if v > myersHeuristicFactor*ec && v > best &&
+					off1+myersSnake <= i1 && i1 < lim1 &&
+					off2+myersSnake <= i2 && i2 < lim2 {
+					for k := 1; m.lineA(i1-k) == m.lineB(i2-k); k++ {
+						if k == myersSnake {
+							best, split1, split2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+
+			if best > 0 {
+				return split1, split2, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+
+				i1 := *kvdb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+
+				if v > myersHeuristicFactor*ec && v > best &&
+					off1 < i1 && i1 <= lim1-myersSnake &&
+					off2 < i2 && i2 <= lim2-myersSnake {
+					for k := 0; m.lineA(i1+k) == m.lineB(i2+k); k++ {
+						if k == myersSnake-1 {
+							best, split1, split2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+
+			if best > 0 {
+				return split1, split2, false, true
+			}
+		}
+
+		// Give up and take whichever search got furthest
+		if ec >= m.maxCost {
+			fbest, fbest1 := -1, -1
+
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := *kvdf(d)
+				if i1 > lim1 {
+					i1 = lim1
+				}
+
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+
+			bbest, bbest1 := maxInt, maxInt
+
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := *kvdb(d)
+				if i1 < off1 {
+					i1 = off1
+				}
+
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
+
+// Match up the lines that appear exactly once in each range, keeping
+// the longest run of them that's in the same order in both, then diff
+// between those. Falls back to Myers when there are none.
+func (d *lineDiffer) patience(aLo, aHi, bLo, bHi int) {
+	if aLo == aHi || bLo == bHi {
+		d.mark(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	const (
+		noMatch = -1
+		many    = -2
+	)
+
+	type occurrence struct {
+		aIndex, bIndex int
+	}
+
+	// The lines of a in the order they first appear
+	var order []*occurrence
+
+	lines := make(map[int]*occurrence)
+
+	for i := aLo; i < aHi; i++ {
+		if o := lines[d.a[i]]; o != nil {
+			o.bIndex = many
+			continue
+		}
+
+		o := &occurrence{aIndex: i, bIndex: noMatch}
+		lines[d.a[i]] = o
+		order = append(order, o)
+	}
+
+	matched := false
+
+	for i := bLo; i < bHi; i++ {
+		o := lines[d.b[i]]
+		if o == nil {
+			continue
+		}
+
+		matched = true
+
+		if o.bIndex == noMatch {
+			o.bIndex = i
+		} else {
+			o.bIndex = many
+		}
+	}
+
+	if !matched {
+		d.mark(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	var (
+		unique    []*occurrence
+		positions []int
+	)
+
+	for _, o := range order {
+		if o.bIndex >= 0 {
+			unique = append(unique, o)
+			positions = append(positions, o.bIndex)
+		}
+	}
+
+	if len(unique) == 0 {
+		d.myers(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	var anchors []*occurrence
+	for _, i := range longestIncreasing(positions) {
+		anchors = append(anchors, unique[i])
+	}
+
+	line1, line2 := aLo, bLo
+
+	for k := 0; ; k++ {
+		// Take in the matching lines either side of the gap before the
+		// next anchor, then diff what's left of it
+		next1, next2 := aHi, bHi
+
+		if k < len(anchors) {
+			next1, next2 = anchors[k].aIndex, anchors[k].bIndex
+
+			for next1 > line1 && next2 > line2 && d.a[next1-1] == d.b[next2-1] {
+				next1--
+				next2--
+			}
+		}
+
+		for line1 < next1 && line2 < next2 && d.a[line1] == d.b[line2] {
+			line1++
+			line2++
+		}
+
+		if next1 > line1 || next2 > line2 {
+			d.patience(line1, next1, line2, next2)
+		}
+
+		if k == len(anchors) {
+			return
+		}
+
+		for k+1 < len(anchors) && anchors[k+1].aIndex == anchors[k].aIndex+1 && anchors[k+1].bIndex == anchors[k].bIndex+1 {
+			k++
+		}
+
+		line1, line2 = anchors[k].aIndex+1, anchors[k].bIndex+1
+	}
+}
+
+// Return the indexes of the longest increasing subsequence of values,
+// found by patience sorting
+func longestIncreasing(values []int) []int {
+	// The index of the value on top of each pile, and for each value
+	// the index of the one on top of the pile to its left when it was
+	// placed
+	var tops []int
+	prev := make([]int, len(values))
+
+	for i, v := range values {
+		lo, hi := 0, len(tops)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if values[tops[mid]] < v {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+
+		prev[i] = -1
+		if lo > 0 {
+			prev[i] = tops[lo-1]
+		}
+
+		if lo == len(tops) {
+			tops = append(tops, i)
+		} else {
+			tops[lo] = i
+		}
+	}
+
+	seq := make([]int, len(tops))
+
+	for i, k := len(tops)-1, tops[len(tops)-1]; i >= 0; i, k = i-1, prev[k] {
+		seq[i] = k
+	}
+
+	return seq
+}
+
+// Find the longest run of lines common to both ranges that contains
+// the lines rarest in a, then diff either side of it. Falls back to
+// Myers when every common line is too common.
+func (d *lineDiffer) histogram(aLo, aHi, bLo, bHi int) {
+	for {
+		if aLo == aHi || bLo == bHi {
+			d.mark(aLo, aHi, bLo, bHi)
+			return
+		}
+
+		as, ae, bs, be, ok, fallBack := d.findRarestRun(aLo, aHi, bLo, bHi)
+
+		switch {
+		case fallBack:
+			d.myers(aLo, aHi, bLo, bHi)
+			return
+		case !ok:
+			d.mark(aLo, aHi, bLo, bHi)
+			return
+		}
+
+		d.histogram(aLo, as, bLo, bs)
+
+		aLo, bLo = ae, be
+	}
+}
+
+// Return the run of common lines histogram diffs around, as half open
+// ranges of a and b. ok is false if the ranges have nothing in
+// common, and fallBack is set if every common line occurs too often.
+func (d *lineDiffer) findRarestRun(aLo, aHi, bLo, bHi int) (as, ae, bs, be int, ok, fallBack bool) {
+	// Where each line occurs in a, and for each line of a the next
+	// place the same line does
+	where := make(map[int][]int)
+	next := make([]int, aHi-aLo)
+
+	for i := aHi - 1; i >= aLo; i-- {
+		occurrences := where[d.a[i]]
+
+		next[i-aLo] = -1
+		if len(occurrences) > 0 {
+			next[i-aLo] = occurrences[0]
+		}
+
+		where[d.a[i]] = append([]int{i}, occurrences...)
+	}
+
+	count := func(i int) int {
+		return len(where[d.a[i]])
+	}
+
+	common := false
+	bestCount := histogramMaxChain + 1
+
+	// The best run, with inclusive ends as xdiff keeps them
+	var best1, bestEnd1, best2, bestEnd2 int
+
+	for bi := bLo; bi < bHi; {
+		bNext := bi + 1
+
+		occurrences := where[d.b[bi]]
+
+		switch {
+		case len(occurrences) == 0:
+		case len(occurrences) > bestCount:
+			common = true
+		default:
+			common = true
+
+			for ai := occurrences[0]; ; {
+				np := next[ai-aLo]
+
+				s1, s2, e1, e2 := ai, bi, ai, bi
+				rc := len(occurrences)
+
+				for aLo < s1 && bLo < s2 && d.a[s1-1] == d.b[s2-1] {
+					s1--
+					s2--
+
+					if rc > 1 && count(s1) < rc {
+						rc = count(s1)
+					}
+				}
+
+				for e1 < aHi-1 && e2 < bHi-1 && d.a[e1+1] == d.b[e2+1] {
+					e1++
+					e2++
+
+					if rc > 1 && count(e1) < rc {
+						rc = count(e1)
+					}
+				}
+
+				if bNext <= e2 {
+					bNext = e2 + 1
+				}
+
+				if bestEnd1-best1 < e1-s1 || rc < bestCount {
+					best1, bestEnd1, best2, bestEnd2 = s1, e1, s2, e2
+					bestCount = rc
+					ok = true
+				}
+
+				for np != -1 && np <= e1 {
+					np = next[np-aLo]
+				}
+
+				if np == -1 {
+					break
+				}
+
+				ai = np
+			}
+		}
+
+		bi = bNext
+	}
+
+	if common && bestCount > histogramMaxChain {
+		return 0, 0, 0, 0, false, true
+	}
+
+	return best1, bestEnd1 + 1, best2, bestEnd2 + 1, ok, false
+}
+
+// Slide each run of changed lines up and down as xdiff does with its
+// indent heuristic off, so that equivalent diffs come out the same.
+// A run ends as far down as it will go, unless it can line up with a
+// run of changes on the other side. Runs that meet are joined.
+func compactChanges(lines []int, changed, otherChanged []bool) {
+	g := &lineGroup{lines: lines, changed: changed}
+	other := &lineGroup{changed: otherChanged}
+
+	g.first()
+	other.first()
+
+	for {
+		if g.end != g.start {
+			var earliestEnd, size int
+
+			// The last end that lines this run up with changes on the
+			// other side, if any
+			endMatchingOther := -1
+
+			for {
+				size = g.end - g.start
+				endMatchingOther = -1
+
+				for g.slideUp() {
+					other.previous()
+				}
+
+				earliestEnd = g.end
+
+				if other.end > other.start {
+					endMatchingOther = g.end
+				}
+
+				for g.slideDown() {
+					other.next()
+
+					if other.end > other.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if size == g.end-g.start {
+					break
+				}
+			}
+
+			if g.end != earliestEnd && endMatchingOther != -1 {
+				for other.end == other.start {
+					g.slideUp()
+					other.previous()
+				}
+			}
+		}
+
+		if !g.next() {
+			break
+		}
+
+		other.next()
+	}
+}
+
+// A run of changed lines, from start up to end, which may be empty
+// between two unchanged lines
+type lineGroup struct {
+	lines   []int
+	changed []bool
+
+	start, end int
+}
+
+func (g *lineGroup) isChanged(i int) bool {
+	return i >= 0 && i < len(g.changed) && g.changed[i]
+}
+
+func (g *lineGroup) first() {
+	g.start, g.end = 0, 0
+	for g.isChanged(g.end) {
+		g.end++
+	}
+}
+
+// Move on to the next group, returning false at the end of the file
+func (g *lineGroup) next() bool {
+	if g.end == len(g.changed) {
+		return false
+	}
+
+	g.start = g.end + 1
+	for g.end = g.start; g.isChanged(g.end); g.end++ {
+	}
+
+	return true
+}
+
+func (g *lineGroup) previous() bool {
+	if g.start == 0 {
+		return false
+	}
+
+	g.end = g.start - 1
+	for g.start = g.end; g.isChanged(g.start - 1); g.start-- {
+	}
+
+	return true
+}
+
+// Move the group down a line if the line after it matches its first,
+// joining any group it runs into
+func (g *lineGroup) slideDown() bool {
+	if g.end >= len(g.lines) || g.lines[g.start] != g.lines[g.end] {
+		return false
+	}
+
+	g.changed[g.start] = false
+	g.changed[g.end] = true
+
+	g.start++
+	g.end++
+
+	for g.isChanged(g.end) {
+		g.end++
+	}
+
+	return true
+}
+
+func (g *lineGroup) slideUp() bool {
+	if g.start == 0 || g.lines[g.start-1] != g.lines[g.end-1] {
+		return false
+	}
+
+	g.start--
+	g.end--
+
+	g.changed[g.start] = true
+	g.changed[g.end] = false
+
+	for g.isChanged(g.start - 1) {
+		g.start--
+	}
+
+	return true
+}
@@ -0,0 +1,100 @@
+package gitreader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Split text into lines the way readLines does
+func splitLines(text string) []string {
+	var lines []string
+
+	for text != "" {
+		i := strings.IndexByte(text, '\n')
+		if i == -1 {
+			return append(lines, text)
+		}
+
+		lines = append(lines, text[:i+1])
+		text = text[i+1:]
+	}
+
+	return lines
+}
+
+// Format the hunks the way they appear in a patch
+func formatHunks(hunks []*Hunk) string {
+	var out []string
+
+	for _, hunk := range hunks {
+		out = append(out, hunk.Header())
+
+		for _, line := range hunk.Lines {
+			out = append(out, string(line.Op)+line.Text)
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		old, new string
+		opts     *TextDiffOptions
+		hunks    string
+	}{
+		{"a\nb\n", "a\nb\n", nil, ""},
+		{"", "a\nb\n", nil, "@@ -0,0 +1,2 @@\n+a\n+b"},
+		{"a\nb\n", "", nil, "@@ -1,2 +0,0 @@\n-a\n-b"},
+		{"a\nb\nc\n", "b\nc\n", &TextDiffOptions{}, "@@ -1 +0,0 @@\n-a"},
+		{"a\nb\nc\n", "a\nb\nc\nd\n", &TextDiffOptions{Context: 1}, "@@ -3 +3,2 @@ b\n c\n+d"},
+
+		// Added lines are shown as far down as they can go
+		{"a\nb\nc\n", "a\nb\nb\nc\n", nil, "@@ -1,3 +1,4 @@\n a\n b\n+b\n c"},
+
+		// Unless they can be lined up with deleted ones
+		{"a\nx\nb\nc\n", "a\nb\nb\nc\n", &TextDiffOptions{}, "@@ -2 +2 @@ a\n-x\n+b"},
+
+		{"a\nb\nc\nd\ne\nf\n", "a\nB\nc\nd\ne\nF\n", &TextDiffOptions{Context: 1}, "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -5,2 +5,2 @@ d\n e\n-f\n+F"},
+		{"a\nb\nc\nd\ne\nf\n", "a\nB\nc\nd\ne\nF\n", &TextDiffOptions{Context: 2}, "@@ -1,6 +1,6 @@\n a\n-b\n+B\n c\n d\n e\n-f\n+F"},
+	}
+
+	for _, test := range tests {
+		hunks := DiffLines(splitLines(test.old), splitLines(test.new), test.opts)
+		assert.Equal(t, test.hunks, formatHunks(hunks), "%q %q", test.old, test.new)
+	}
+}
+
+func TestDiffLinesAlgorithms(t *testing.T) {
+	old := "a\ny\nc\ny\nb\n"
+	new := "b\nc\na\ny\n"
+
+	tests := []struct {
+		algorithm DiffAlgorithm
+		hunks     string
+	}{
+		{DiffMyers, "@@ -1,5 +1,4 @@\n-a\n-y\n+b\n c\n+a\n y\n-b"},
+		{DiffPatience, "@@ -1,5 +1,4 @@\n-a\n-y\n-c\n-y\n b\n+c\n+a\n+y"},
+		{DiffHistogram, "@@ -1,5 +1,4 @@\n+b\n+c\n a\n y\n-c\n-y\n-b"},
+	}
+
+	for _, test := range tests {
+		hunks := DiffLines(splitLines(old), splitLines(new), &TextDiffOptions{Algorithm: test.algorithm, Context: 3})
+		assert.Equal(t, test.hunks, formatHunks(hunks))
+	}
+}
+
+func TestFindSection(t *testing.T) {
+	lines := splitLines("package main\n\n  indented\n" + strings.Repeat("x", 100) + "  \n\tbody\n")
+
+	assert.Equal(t, "", findSection(lines, 0))
+	assert.Equal(t, "package main", findSection(lines, 3))
+	assert.Equal(t, strings.Repeat("x", 80), findSection(lines, 5))
+}
+
+func TestLongestIncreasing(t *testing.T) {
+	assert.Equal(t, []int{0, 2, 3}, longestIncreasing([]int{1, 5, 2, 3}))
+	assert.Equal(t, []int{1, 2, 3}, longestIncreasing([]int{3, 0, 1, 2}))
+}
@@ -0,0 +1,137 @@
+package gitreader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options for DiscoverRepo. These correspond to git's GIT_DIR,
+// GIT_WORK_TREE and GIT_CEILING_DIRECTORIES environment variables,
+// but are only ever taken from here, never from the environment.
+type DiscoverOptions struct {
+	// Use this git directory instead of searching for one
+	GitDir string
+
+	// The top of the working tree to use with GitDir. If empty,
+	// the starting path is taken to be the top, as in git.
+	WorkTree string
+
+	// The search will not move up into any of these directories
+	CeilingDirs []string
+}
+
+// Find the repository containing path by checking path and then each
+// of its parents for a .git directory or file, or for a bare repo,
+// the way git does when run from a subdirectory.
+//
+// Along with the repo, return the location of path relative to the
+// top of the working tree, such as "app/models/". The prefix is empty
+// when path is the top of the working tree, or the repo is bare, or
+// path is inside the git directory.
+func DiscoverRepo(path string, opts *DiscoverOptions) (*Repo, string, error) {
+	if opts == nil {
+		opts = &DiscoverOptions{}
+	}
+
+	start, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if opts.GitDir != "" {
+		return discoverExplicit(start, opts)
+	}
+
+	ceilings := make(map[string]bool)
+	for _, dir := range opts.CeilingDirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			ceilings[abs] = true
+		}
+	}
+
+	dir := start
+
+	for {
+		repo, err := openGitDir(filepath.Join(dir, ".git"))
+		if err == nil {
+			repo.WorkTree = dir
+
+			prefix, _ := worktreePrefix(dir, start)
+			return repo, prefix, nil
+		}
+
+		if err != ErrInvalidRepo {
+			return nil, "", err
+		}
+
+		if isGitDir(dir) {
+			repo, err := openGitDir(dir)
+			if err != nil {
+				return nil, "", err
+			}
+
+			return repo, "", nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir || ceilings[parent] {
+			return nil, "", ErrInvalidRepo
+		}
+
+		dir = parent
+	}
+}
+
+func discoverExplicit(start string, opts *DiscoverOptions) (*Repo, string, error) {
+	repo, err := openGitDir(opts.GitDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if opts.WorkTree == "" {
+		repo.WorkTree = start
+		return repo, "", nil
+	}
+
+	top, err := filepath.Abs(opts.WorkTree)
+	if err != nil {
+		repo.Close()
+		return nil, "", err
+	}
+
+	repo.WorkTree = top
+
+	prefix, _ := worktreePrefix(top, start)
+	return repo, prefix, nil
+}
+
+// Return path relative to top, in the form git uses for prefixes.
+// The bool is false if path is outside of top.
+func worktreePrefix(top, path string) (string, bool) {
+	rel, err := filepath.Rel(top, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	if rel == "." {
+		return "", true
+	}
+
+	return filepath.ToSlash(rel) + "/", true
+}
+
+// Report whether dir looks like a git directory itself, either
+// because it's bare or because the search started inside .git
+func isGitDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return false
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "commondir")); err == nil {
+		return true
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "objects"))
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,122 @@
+package gitreader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverRepoFromSubdir(t *testing.T) {
+	repo, prefix, err := DiscoverRepo("fixtures/proj/app", nil)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	top, err := filepath.Abs("fixtures/proj")
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(top, ".git"), repo.Base)
+	assert.Equal(t, top, repo.WorkTree)
+	assert.Equal(t, "app/", prefix)
+
+	id, err := repo.Resolve("HEAD", prefix+"config.rb")
+	require.NoError(t, err)
+
+	assert.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a", id)
+}
+
+func TestDiscoverRepoAtTop(t *testing.T) {
+	repo, prefix, err := DiscoverRepo("fixtures/proj", nil)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	assert.Equal(t, "", prefix)
+}
+
+func TestDiscoverRepoInsideGitDir(t *testing.T) {
+	repo, prefix, err := DiscoverRepo("fixtures/history.git/objects/pack", nil)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	abs, err := filepath.Abs("fixtures/history.git")
+	require.NoError(t, err)
+
+	assert.Equal(t, abs, repo.Base)
+	assert.Equal(t, "", repo.WorkTree)
+	assert.Equal(t, "", prefix)
+}
+
+func TestDiscoverRepoCeiling(t *testing.T) {
+	_, _, err := DiscoverRepo("fixtures/proj/app", &DiscoverOptions{
+		CeilingDirs: []string{"fixtures/proj"},
+	})
+
+	assert.Equal(t, ErrInvalidRepo, err)
+}
+
+func TestDiscoverRepoGitDirFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	wt, err := filepath.Abs("fixtures/history.git/worktrees/wt")
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+wt+"\n"), 0644)
+	require.NoError(t, err)
+
+	sub := filepath.Join(dir, "src", "deep")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+
+	repo, prefix, err := DiscoverRepo(sub, &DiscoverOptions{CeilingDirs: []string{filepath.Dir(dir)}})
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	assert.Equal(t, dir, repo.WorkTree)
+	assert.Equal(t, "src/deep/", prefix)
+
+	id, err := repo.ResolveRef("HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "7d4990f38518569153e837970474000ac532def5", id)
+}
+
+func TestDiscoverRepoExplicitGitDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "docs")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+
+	repo, prefix, err := DiscoverRepo(sub, &DiscoverOptions{
+		GitDir:   "fixtures/history.git",
+		WorkTree: dir,
+	})
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	assert.Equal(t, "docs/", prefix)
+	assert.Equal(t, dir, repo.WorkTree)
+
+	repo2, prefix, err := DiscoverRepo(sub, &DiscoverOptions{GitDir: "fixtures/history.git"})
+	require.NoError(t, err)
+
+	defer repo2.Close()
+
+	assert.Equal(t, "", prefix)
+	assert.Equal(t, sub, repo2.WorkTree)
+
+	_, _, err = DiscoverRepo(sub, &DiscoverOptions{GitDir: dir})
+	assert.Equal(t, ErrInvalidRepo, err)
+}
@@ -0,0 +1,560 @@
+package gitreader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The kinds of problem reported by Fsck
+type FsckKind string
+
+const (
+	// A pack, index or multi-pack-index doesn't match its trailing
+	// checksum
+	FsckBadChecksum FsckKind = "bad-checksum"
+
+	// An index is truncated or doesn't describe its pack
+	FsckBadIndex FsckKind = "bad-index"
+
+	// The CRC32 of a packed object doesn't match the one in the index
+	FsckBadCRC FsckKind = "bad-crc"
+
+	// An object's content doesn't hash to its id
+	FsckHashMismatch FsckKind = "hash-mismatch"
+
+	// An object couldn't be read or parsed
+	FsckBadObject FsckKind = "bad-object"
+
+	// The base of a delta isn't an object in the same pack
+	FsckBadDeltaBase FsckKind = "bad-delta-base"
+
+	// A tree's entries are out of order or repeat a name
+	FsckTreeNotSorted FsckKind = "tree-not-sorted"
+
+	// A tree entry has a mode git would never write
+	FsckBadTreeMode FsckKind = "bad-tree-mode"
+
+	// A commit, tag or tree refers to an object that doesn't exist
+	FsckMissingObject FsckKind = "missing-object"
+
+	// A ref points to an object or ref that doesn't exist
+	FsckDanglingRef FsckKind = "dangling-ref"
+
+	// A ref can't be read or doesn't hold an object id
+	FsckBadRef FsckKind = "bad-ref"
+)
+
+// A problem found by Fsck
+type FsckFinding struct {
+	Kind FsckKind
+
+	// The object the problem is with, if any
+	Id string
+
+	// The file or ref the problem was found in, if any
+	Path string
+
+	Message string
+}
+
+func (f *FsckFinding) String() string {
+	where := string(f.Kind)
+
+	for _, part := range []string{f.Path, f.Id} {
+		if part != "" {
+			where += " " + part
+		}
+	}
+
+	return where + ": " + f.Message
+}
+
+// The modes git writes for tree entries
+var treeModes = map[string]bool{
+	"100644": true,
+	"100755": true,
+	"120000": true,
+	"40000":  true,
+	"160000": true,
+}
+
+// Check the integrity of every loose object and pack in the repo, and
+// that every ref points at an object that exists. Rather than
+// stopping at the first problem, everything is checked and a finding
+// is returned for each problem. The error is only set when the check
+// itself can't be carried out.
+func (r *Repo) Fsck() ([]*FsckFinding, error) {
+	f := &fsck{
+		repo:      r,
+		present:   make(map[string]bool),
+		referrers: make(map[string]string),
+	}
+
+	for _, loader := range r.Loaders {
+		switch l := loader.(type) {
+		case *LooseObject:
+			err := f.checkLoose(l)
+			if err != nil {
+				return nil, err
+			}
+		case *Pack:
+			f.checkPack(l)
+		case *MultiPackIndex:
+			f.checkMultiPackIndex(l)
+
+			for _, pack := range l.packs {
+				f.checkPack(pack)
+			}
+		}
+	}
+
+	f.checkConnectivity()
+
+	err := f.checkRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	return f.findings, nil
+}
+
+type fsck struct {
+	repo     *Repo
+	findings []*FsckFinding
+
+	// Every object id that was found
+	present map[string]bool
+
+	// Every object id that is referred to, and the first object
+	// found referring to it
+	referrers map[string]string
+}
+
+func (f *fsck) report(kind FsckKind, id, path, format string, args ...interface{}) {
+	f.findings = append(f.findings, &FsckFinding{kind, id, path, fmt.Sprintf(format, args...)})
+}
+
+func (f *fsck) refer(id, from string) {
+	if _, ok := f.referrers[id]; !ok {
+		f.referrers[id] = from
+	}
+}
+
+// Check whether the object id is in the repo without reading it
+func (f *fsck) exists(id string) bool {
+	if f.present[id] {
+		return true
+	}
+
+	if !f.repo.isObjectId(id) {
+		return false
+	}
+
+	for _, loader := range f.repo.Loaders {
+		switch l := loader.(type) {
+		case *LooseObject:
+			if _, err := os.Stat(filepath.Join(l.dir(), id[:2], id[2:])); err == nil {
+				return true
+			}
+		case *Pack:
+			if _, err := l.FindOffset(id); err == nil {
+				return true
+			}
+		case *MultiPackIndex:
+			if _, _, err := l.FindOffset(id); err == nil {
+				return true
+			}
+		default:
+			// The object may be in a store that we don't know how
+			// to check
+			obj, err := l.LoadObject(id)
+			if err == nil {
+				obj.Close()
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (f *fsck) checkLoose(l *LooseObject) error {
+	format := l.format()
+
+	dirs, err := ioutil.ReadDir(l.dir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(l.dir(), dir.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			id := dir.Name() + file.Name()
+			if len(id) != format.HexSize() || !isHex(id) {
+				continue
+			}
+
+			f.checkLooseObject(id, filepath.Join(l.dir(), dir.Name(), file.Name()), format)
+		}
+	}
+
+	return nil
+}
+
+func (f *fsck) checkLooseObject(id, path string, format *ObjectFormat) {
+	file, err := os.Open(path)
+	if err != nil {
+		f.report(FsckBadObject, id, path, "%s", err)
+		return
+	}
+
+	defer file.Close()
+
+	obj, err := ParseObject(file)
+	if err != nil {
+		f.report(FsckBadObject, id, path, "%s", err)
+		return
+	}
+
+	defer obj.Close()
+
+	content, err := ioutil.ReadAll(obj.body)
+	if err != nil {
+		f.report(FsckBadObject, id, path, "%s", err)
+		return
+	}
+
+	f.checkObject(id, obj.Type, obj.Size, content, format, path)
+}
+
+// Check the trailing checksums of p and its index, then every object
+// listed in the index
+func (f *fsck) checkPack(p *Pack) {
+	format := p.objectFormat()
+	size := format.Size
+
+	if len(p.data) < 12+size {
+		f.report(FsckBadIndex, "", p.dataPath, "pack is truncated")
+		return
+	}
+
+	trailer := p.data[len(p.data)-size:]
+
+	if !bytes.Equal(checksum(format, p.data[:len(p.data)-size]), trailer) {
+		f.report(FsckBadChecksum, "", p.dataPath, "pack checksum mismatch")
+	}
+
+	count := p.ids().count
+
+	// The index ends with the pack's checksum and then its own
+	need := 1032 + uint64(count)*uint64(size+8) + 2*uint64(size)
+	if p.indexVersion == 1 {
+		need = 1024 + uint64(count)*uint64(size+4) + 2*uint64(size)
+	}
+
+	if uint64(len(p.index)) < need {
+		f.report(FsckBadIndex, "", p.idxPath, "index is truncated")
+		return
+	}
+
+	idxEnd := len(p.index) - size
+
+	if !bytes.Equal(checksum(format, p.index[:idxEnd]), p.index[idxEnd:]) {
+		f.report(FsckBadChecksum, "", p.idxPath, "index checksum mismatch")
+	}
+
+	if !bytes.Equal(p.index[idxEnd-size:idxEnd], trailer) {
+		f.report(FsckBadIndex, "", p.idxPath, "index is for a different pack")
+	}
+
+	if packed := order.Uint32(p.data[8:]); packed != count {
+		f.report(FsckBadIndex, "", p.idxPath, "index lists %d objects but the pack has %d", count, packed)
+	}
+
+	dataEnd := uint64(len(p.data) - size)
+
+	offsets := make([]uint64, count)
+	starts := make(map[uint64]bool)
+
+	for n := uint32(0); n < count; n++ {
+		offset, err := p.offsetAt(n)
+		if err != nil {
+			f.report(FsckBadIndex, hex.EncodeToString(p.idAt(n)), p.idxPath, "large offset is outside the index")
+			return
+		}
+
+		offsets[n] = offset
+		starts[offset] = true
+	}
+
+	sorted := append([]uint64(nil), offsets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for n := uint32(0); n < count; n++ {
+		id := hex.EncodeToString(p.idAt(n))
+		offset := offsets[n]
+
+		if offset < 12 || offset >= dataEnd {
+			f.report(FsckBadIndex, id, p.idxPath, "offset %d is outside the pack", offset)
+			continue
+		}
+
+		// Each entry runs up to the one after it, or the trailer
+		end := dataEnd
+		if next := sort.Search(len(sorted), func(i int) bool { return sorted[i] > offset }); next < len(sorted) {
+			end = sorted[next]
+		}
+
+		if p.indexVersion == 2 {
+			crc := order.Uint32(p.index[1032+uint64(count)*uint64(size)+4*uint64(n):])
+			if crc32.ChecksumIEEE(p.data[offset:end]) != crc {
+				f.report(FsckBadCRC, id, p.dataPath, "CRC32 mismatch at offset %d", offset)
+			}
+		}
+
+		entry, err := p.readEntry(offset)
+		if err != nil {
+			f.report(FsckBadObject, id, p.dataPath, "%s", err)
+			continue
+		}
+
+		switch entry.typ {
+		case _OBJ_OFS_DELTA:
+			if !starts[entry.baseOffset] {
+				f.report(FsckBadDeltaBase, id, p.dataPath, "delta base at offset %d is not an object", entry.baseOffset)
+				continue
+			}
+		case _OBJ_REF_DELTA:
+			if _, err := p.FindOffset(entry.baseId); err != nil {
+				f.report(FsckBadDeltaBase, id, p.dataPath, "delta base %s is not in the pack", entry.baseId)
+				continue
+			}
+		}
+
+		obj, err := p.readObject(offset)
+		if err != nil {
+			f.report(FsckBadObject, id, p.dataPath, "%s", err)
+			continue
+		}
+
+		content, err := ioutil.ReadAll(obj.body)
+		obj.Close()
+
+		if err != nil {
+			f.report(FsckBadObject, id, p.dataPath, "%s", err)
+			continue
+		}
+
+		f.checkObject(id, obj.Type, obj.Size, content, format, p.dataPath)
+	}
+}
+
+func (f *fsck) checkMultiPackIndex(m *MultiPackIndex) {
+	size := m.format.Size
+
+	if len(m.data) < size || !bytes.Equal(checksum(m.format, m.data[:len(m.data)-size]), m.data[len(m.data)-size:]) {
+		f.report(FsckBadChecksum, "", m.path, "multi-pack-index checksum mismatch")
+	}
+}
+
+func checksum(format *ObjectFormat, data []byte) []byte {
+	h := format.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Check that content hashes to id and parses as typ, and note the
+// objects it refers to
+func (f *fsck) checkObject(id, typ string, size uint64, content []byte, format *ObjectFormat, path string) {
+	if uint64(len(content)) != size {
+		f.report(FsckBadObject, id, path, "object is %d bytes but its header says %d", len(content), size)
+	}
+
+	h := format.New()
+	fmt.Fprintf(h, "%s %d\x00", typ, len(content))
+	h.Write(content)
+
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != id {
+		f.report(FsckHashMismatch, id, path, "content hashes to %s", sum)
+	}
+
+	f.present[id] = true
+
+	rdr := closableReader{bytes.NewReader(content)}
+
+	obj := &Object{
+		Type:     typ,
+		Size:     uint64(len(content)),
+		input:    rdr,
+		body:     bufio.NewReader(rdr),
+		hashSize: format.Size,
+	}
+
+	switch typ {
+	case "commit":
+		commit, err := obj.Commit()
+		if err != nil {
+			f.report(FsckBadObject, id, path, "%s", err)
+			return
+		}
+
+		if commit.Tree == "" {
+			f.report(FsckBadObject, id, path, "commit has no tree")
+			return
+		}
+
+		for _, ref := range append([]string{commit.Tree}, commit.Parents...) {
+			if !isFormatId(ref, format) {
+				f.report(FsckBadObject, id, path, "bad id %q", ref)
+				return
+			}
+		}
+
+		f.refer(commit.Tree, id)
+
+		for _, parent := range commit.Parents {
+			f.refer(parent, id)
+		}
+	case "tag":
+		tag, err := obj.Tag()
+		if err != nil {
+			f.report(FsckBadObject, id, path, "%s", err)
+			return
+		}
+
+		switch {
+		case tag.Object == "":
+			f.report(FsckBadObject, id, path, "tag has no object")
+		case !isFormatId(tag.Object, format):
+			f.report(FsckBadObject, id, path, "bad id %q", tag.Object)
+		default:
+			f.refer(tag.Object, id)
+		}
+	case "tree":
+		f.checkTree(id, content, format, path)
+	case "blob":
+	default:
+		f.report(FsckBadObject, id, path, "unknown object type %q", typ)
+	}
+}
+
+// Whether id is a full object id in format
+func isFormatId(id string, format *ObjectFormat) bool {
+	return len(id) == format.HexSize() && isHex(id)
+}
+
+// Check that the entries of a tree use valid modes and are sorted the
+// way git sorts them, where a subtree sorts as if its name ended in /
+func (f *fsck) checkTree(id string, content []byte, format *ObjectFormat, path string) {
+	var prev, prevName string
+
+	for first := true; len(content) > 0; first = false {
+		space := bytes.IndexByte(content, ' ')
+		nul := bytes.IndexByte(content, 0)
+
+		if space == -1 || nul < space || nul+1+format.Size > len(content) {
+			f.report(FsckBadObject, id, path, "truncated tree entry")
+			return
+		}
+
+		mode := string(content[:space])
+		name := string(content[space+1 : nul])
+		entryId := hex.EncodeToString(content[nul+1 : nul+1+format.Size])
+
+		content = content[nul+1+format.Size:]
+
+		if !treeModes[mode] {
+			f.report(FsckBadTreeMode, id, path, "entry %q has mode %s", name, mode)
+		}
+
+		key := treeSortKey(name, mode)
+
+		switch {
+		case first:
+		case name == prevName:
+			f.report(FsckTreeNotSorted, id, path, "duplicate entry %q", name)
+		case key < prev:
+			f.report(FsckTreeNotSorted, id, path, "entry %q is out of order", name)
+		}
+
+		prev, prevName = key, name
+
+		// Submodule commits live in another repo
+		if mode != "160000" {
+			f.refer(entryId, id)
+		}
+	}
+}
+
+func (f *fsck) checkConnectivity() {
+	ids := make([]string, 0, len(f.referrers))
+	for id := range f.referrers {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if !f.exists(id) {
+			f.report(FsckMissingObject, id, "", "missing object referenced by %s", f.referrers[id])
+		}
+	}
+}
+
+func (f *fsck) checkRefs() error {
+	refs, err := f.repo.listRefs("", f.brokenRef)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.Id != "" && !f.exists(ref.Id) {
+			f.report(FsckDanglingRef, ref.Id, ref.Name, "ref points to a missing object")
+		}
+	}
+
+	id, ok, err := f.repo.lookupRef("HEAD")
+	if err != nil {
+		// HEAD is allowed to point at a branch that doesn't exist yet
+		if err != ErrUnknownRef {
+			f.brokenRef("HEAD", err)
+		}
+
+		return nil
+	}
+
+	if ok && !f.exists(id) {
+		f.report(FsckDanglingRef, id, "HEAD", "ref points to a missing object")
+	}
+
+	return nil
+}
+
+// Report a ref that couldn't be read
+func (f *fsck) brokenRef(name string, err error) {
+	if err == ErrUnknownRef {
+		f.report(FsckDanglingRef, "", name, "symbolic ref points to a missing ref")
+		return
+	}
+
+	f.report(FsckBadRef, "", name, "%s", err)
+}
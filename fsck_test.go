@@ -0,0 +1,295 @@
+package gitreader
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFsckClean(t *testing.T) {
+	for _, path := range []string{"fixtures/history.git", "fixtures/sha256.git", "fixtures/midx.git", "fixtures/tags.git"} {
+		repo, err := OpenRepo(path)
+		require.NoError(t, err)
+
+		defer repo.Close()
+
+		findings, err := repo.Fsck()
+		require.NoError(t, err)
+
+		assert.Empty(t, findings, path)
+	}
+}
+
+func copyDir(t *testing.T, src, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filepath.Join(dst, rel), data, 0644)
+	})
+
+	require.NoError(t, err)
+}
+
+func writeLooseObject(t *testing.T, dir, id, typ string, content []byte) {
+	var compress bytes.Buffer
+
+	zw := zlib.NewWriter(&compress)
+	fmt.Fprintf(zw, "%s %d\x00", typ, len(content))
+	zw.Write(content)
+	zw.Close()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "objects", id[:2]), 0755))
+
+	err := ioutil.WriteFile(filepath.Join(dir, "objects", id[:2], id[2:]), compress.Bytes(), 0644)
+	require.NoError(t, err)
+}
+
+func findFinding(findings []*FsckFinding, kind FsckKind, id string) *FsckFinding {
+	for _, finding := range findings {
+		if finding.Kind == kind && finding.Id == id {
+			return finding
+		}
+	}
+
+	return nil
+}
+
+func TestFsckFindsProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	copyDir(t, "fixtures/history.git", dir)
+
+	packPath := filepath.Join(dir, "objects", "pack", "pack-e54d54cc1b04cf2f7acbdbb1103a5635318c0ea4")
+
+	// Damage the compressed data of logo.png
+	logo := "a80ba770ef1bde4b48403b666eaa3fc41113a070"
+
+	pack, err := LoadPack("fixtures/history.git/objects/pack/pack-e54d54cc1b04cf2f7acbdbb1103a5635318c0ea4")
+	require.NoError(t, err)
+
+	offset, err := pack.FindOffset(logo)
+	require.NoError(t, err)
+
+	entry, err := pack.readEntry(offset)
+	require.NoError(t, err)
+
+	pack.Close()
+
+	data, err := ioutil.ReadFile(packPath + ".pack")
+	require.NoError(t, err)
+
+	data[entry.data+10] ^= 0xff
+
+	require.NoError(t, ioutil.WriteFile(packPath+".pack", data, 0644))
+
+	// A loose object stored under the wrong id
+	writeLooseObject(t, dir, "39cc8d82f469e798ce1b8be2483079ee67db92db", "blob", []byte("hello"))
+
+	// A tree with a bad mode, entries out of order, and an entry
+	// for an object that doesn't exist
+	existing, _ := hex.DecodeString("61780798228d17af2d34fce4cfbdf35556832472")
+	missing, _ := hex.DecodeString("2222222222222222222222222222222222222222")
+
+	var tree bytes.Buffer
+	tree.WriteString("100644 b.txt\x00")
+	tree.Write(existing)
+	tree.WriteString("100664 a.txt\x00")
+	tree.Write(missing)
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("tree %d\x00%s", tree.Len(), tree.String())))
+	treeId := hex.EncodeToString(sum[:])
+
+	writeLooseObject(t, dir, treeId, "tree", tree.Bytes())
+
+	// A tag with no object, and a commit with a short tree id
+	tagBody := []byte("type commit\ntag x\n\nmsg\n")
+	sum = sha1.Sum([]byte(fmt.Sprintf("tag %d\x00%s", len(tagBody), tagBody)))
+	tagId := hex.EncodeToString(sum[:])
+
+	writeLooseObject(t, dir, tagId, "tag", tagBody)
+
+	commitBody := []byte("tree ab\nauthor A <a@b> 0 +0000\ncommitter A <a@b> 0 +0000\n\nmsg\n")
+	sum = sha1.Sum([]byte(fmt.Sprintf("commit %d\x00%s", len(commitBody), commitBody)))
+	commitId := hex.EncodeToString(sum[:])
+
+	writeLooseObject(t, dir, commitId, "commit", commitBody)
+
+	// A branch pointing at nothing. Git doesn't track the empty
+	// refs/heads directory of the fixture.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "refs", "heads"), 0755))
+
+	err = ioutil.WriteFile(filepath.Join(dir, "refs", "heads", "broken"), []byte("1111111111111111111111111111111111111111\n"), 0644)
+	require.NoError(t, err)
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	findings, err := repo.Fsck()
+	require.NoError(t, err)
+
+	finding := findFinding(findings, FsckBadChecksum, "")
+	require.NotNil(t, finding)
+	assert.Equal(t, packPath+".pack", finding.Path)
+
+	assert.NotNil(t, findFinding(findings, FsckBadCRC, logo))
+	assert.NotNil(t, findFinding(findings, FsckBadObject, logo))
+
+	finding = findFinding(findings, FsckHashMismatch, "39cc8d82f469e798ce1b8be2483079ee67db92db")
+	require.NotNil(t, finding)
+	assert.Equal(t, "content hashes to b6fc4c620b67d95f953a5c1c1230aaab5db5a1b0", finding.Message)
+
+	finding = findFinding(findings, FsckBadTreeMode, treeId)
+	require.NotNil(t, finding)
+	assert.Equal(t, `entry "a.txt" has mode 100664`, finding.Message)
+
+	finding = findFinding(findings, FsckTreeNotSorted, treeId)
+	require.NotNil(t, finding)
+	assert.Equal(t, `entry "a.txt" is out of order`, finding.Message)
+
+	finding = findFinding(findings, FsckMissingObject, "2222222222222222222222222222222222222222")
+	require.NotNil(t, finding)
+	assert.Equal(t, "missing object referenced by "+treeId, finding.Message)
+
+	finding = findFinding(findings, FsckBadObject, tagId)
+	require.NotNil(t, finding)
+	assert.Equal(t, "tag has no object", finding.Message)
+
+	finding = findFinding(findings, FsckBadObject, commitId)
+	require.NotNil(t, finding)
+	assert.Equal(t, `bad id "ab"`, finding.Message)
+
+	finding = findFinding(findings, FsckDanglingRef, "1111111111111111111111111111111111111111")
+	require.NotNil(t, finding)
+	assert.Equal(t, "refs/heads/broken", finding.Path)
+
+	// Nothing else in the pack was damaged
+	for _, finding := range findings {
+		if finding.Path == packPath+".pack" && finding.Id != "" {
+			assert.Equal(t, logo, finding.Id, finding.String())
+		}
+	}
+}
+
+func TestFsckBrokenRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	copyDir(t, "fixtures/tags.git", dir)
+
+	// A tag whose target has been deleted
+	body := []byte("object 1111111111111111111111111111111111111111\ntype commit\ntag gone\n\nmsg\n")
+	sum := sha1.Sum([]byte(fmt.Sprintf("tag %d\x00%s", len(body), body)))
+	tagId := hex.EncodeToString(sum[:])
+
+	writeLooseObject(t, dir, tagId, "tag", body)
+
+	for _, sub := range []string{"heads", "tags"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "refs", sub), 0755))
+	}
+
+	refs := map[string]string{
+		"refs/tags/gone":   tagId,
+		"refs/heads/empty": "",
+		"refs/heads/loop":  "ref: refs/heads/loop",
+	}
+
+	for name, contents := range refs {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents+"\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	findings, err := repo.Fsck()
+	require.NoError(t, err)
+
+	finding := findFinding(findings, FsckMissingObject, "1111111111111111111111111111111111111111")
+	require.NotNil(t, finding)
+	assert.Equal(t, "missing object referenced by "+tagId, finding.Message)
+
+	finding = findFinding(findings, FsckBadRef, "")
+	require.NotNil(t, finding)
+	assert.Equal(t, "refs/heads/empty", finding.Path)
+
+	finding = findFinding(findings, FsckDanglingRef, "")
+	require.NotNil(t, finding)
+	assert.Equal(t, "refs/heads/loop", finding.Path)
+}
+
+func TestFsckDeltaCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	copyDir(t, "fixtures/tags.git", dir)
+	copyDir(t, "fixtures/delta-cycle", filepath.Join(dir, "objects", "pack"))
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	findings, err := repo.Fsck()
+	require.NoError(t, err)
+
+	for _, id := range []string{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"} {
+		finding := findFinding(findings, FsckBadObject, id)
+		require.NotNil(t, finding, id)
+		assert.Equal(t, ErrBadDelta.Error(), finding.Message)
+	}
+}
+
+func TestCheckTreeOrder(t *testing.T) {
+	f := &fsck{present: make(map[string]bool), referrers: make(map[string]string)}
+
+	id := make([]byte, 20)
+
+	// A subtree sorts as if its name ended in a slash, so "a.c"
+	// comes before the tree "a"
+	var tree bytes.Buffer
+	for _, entry := range []string{"100644 a.c", "40000 a", "100644 a0", "100644 a0"} {
+		tree.WriteString(entry + "\x00")
+		tree.Write(id)
+	}
+
+	f.checkTree("t", tree.Bytes(), SHA1, "")
+
+	require.Equal(t, 1, len(f.findings))
+	assert.Equal(t, `duplicate entry "a0"`, f.findings[0].Message)
+}
@@ -0,0 +1,45 @@
+package gitreader
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"strings"
+)
+
+// The hash function a repository uses to name its objects
+type ObjectFormat struct {
+	// The name used by extensions.objectFormat
+	Name string
+
+	// The length of an object id in bytes
+	Size int
+
+	New func() hash.Hash
+}
+
+var (
+	SHA1   = &ObjectFormat{"sha1", 20, sha1.New}
+	SHA256 = &ObjectFormat{"sha256", 32, sha256.New}
+)
+
+var ErrUnknownObjectFormat = errors.New("unknown object format")
+
+// The length of an object id written out in hex
+func (f *ObjectFormat) HexSize() int {
+	return 2 * f.Size
+}
+
+// Return the ObjectFormat called name, as it would be given in
+// extensions.objectFormat
+func LookupObjectFormat(name string) (*ObjectFormat, error) {
+	switch strings.ToLower(name) {
+	case "sha1":
+		return SHA1, nil
+	case "sha256":
+		return SHA256, nil
+	}
+
+	return nil, ErrUnknownObjectFormat
+}
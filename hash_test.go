@@ -0,0 +1,112 @@
+package gitreader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupObjectFormat(t *testing.T) {
+	format, err := LookupObjectFormat("sha256")
+	require.NoError(t, err)
+
+	assert.Equal(t, SHA256, format)
+	assert.Equal(t, 64, format.HexSize())
+
+	_, err = LookupObjectFormat("md5")
+	assert.Equal(t, ErrUnknownObjectFormat, err)
+}
+
+func TestSHA256Repo(t *testing.T) {
+	repo, err := OpenRepo("fixtures/sha256.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	assert.Equal(t, SHA256, repo.Format)
+
+	// Only the multi-pack-index and loose objects should be in use
+	var midx bool
+	for _, loader := range repo.Loaders {
+		_, isPack := loader.(*Pack)
+		assert.False(t, isPack)
+
+		if _, ok := loader.(*MultiPackIndex); ok {
+			midx = true
+		}
+	}
+
+	assert.True(t, midx)
+
+	// A loose commit
+	id, err := repo.ResolveRef("main")
+	require.NoError(t, err)
+
+	assert.Equal(t, "45fe3466bbbbf7222bceba897f281bac98417dd8f9ca7140702d012c0c9a510d", id)
+
+	id, err = repo.Resolve("main", "README")
+	require.NoError(t, err)
+
+	assert.Equal(t, "49ee58532156abdb234e5a8c940c0b7a605562d32cfeedcb6369f3fb5a5818bd", id)
+
+	// Packed objects
+	id, err = repo.RevParse("v1.0")
+	require.NoError(t, err)
+
+	assert.Equal(t, "6e909e95963fac7fd6acfbd0745cb5930eacb7e7245107c03118225e3a0d317f", id)
+
+	id, err = repo.RevParse("v1.0^{tree}")
+	require.NoError(t, err)
+
+	assert.Equal(t, "97e4c4debfc8650f96aa161a99b83ae8047b2b8eb40f5511aad32453a0c90c11", id)
+
+	id, err = repo.RevParse("main~1:src/main.go")
+	require.NoError(t, err)
+
+	assert.Equal(t, "b73d5358ea987b263c33b57275fe138add89601b4aae10f387d914d24bb0d78a", id)
+}
+
+func TestSHA256RefDelta(t *testing.T) {
+	repo, err := OpenRepo("fixtures/sha256.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	// Stored as a REF_DELTA against the next version of the file
+	blob, err := repo.CatFile("main~2", "src/main.go")
+	require.NoError(t, err)
+
+	data, err := blob.Bytes()
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	assert.Equal(t, 40, len(lines))
+	assert.Equal(t, "line 40 of the main program", lines[39])
+}
+
+func TestSHA256Ids(t *testing.T) {
+	repo, err := OpenRepo("fixtures/sha256.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	// A full SHA-1 length id is only a prefix here
+	id, err := repo.ResolvePrefix("11315fefa72ed635c3155d5155c5f1713368db86")
+	require.NoError(t, err)
+
+	assert.Equal(t, "11315fefa72ed635c3155d5155c5f1713368db865c52e8e38f6f88cc79340e95", id)
+
+	id, err = repo.RevParse("45fe34")
+	require.NoError(t, err)
+
+	assert.Equal(t, "45fe3466bbbbf7222bceba897f281bac98417dd8f9ca7140702d012c0c9a510d", id)
+
+	assert.True(t, repo.isObjectId(id))
+	assert.False(t, repo.isObjectId(id[:40]))
+
+	_, err = repo.ResolvePrefix(id + "0")
+	assert.Equal(t, ErrBadPrefix, err)
+}
@@ -0,0 +1,84 @@
+package gitreader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// A sorted list of object ids along with the 256 entry fan-out table
+// that counts how many of them start with each byte or a lower one.
+// Pack indexes, multi-pack-indexes and commit-graphs all store their
+// ids this way.
+type idTable struct {
+	fanout []byte
+	idAt   func(n uint32) []byte
+	count  uint32
+}
+
+// Return the range of positions holding ids that start with the byte
+// b. A fan-out table that runs past the ids gives an empty range.
+func (t idTable) fanoutRange(b byte) (uint32, uint32) {
+	var lo uint32
+	if b > 0 {
+		lo = order.Uint32(t.fanout[4*(int(b)-1):])
+	}
+
+	hi := order.Uint32(t.fanout[4*int(b):])
+
+	if hi > t.count || lo > hi {
+		return 0, 0
+	}
+
+	return lo, hi
+}
+
+// Return the position of the first id that isn't less than id,
+// along with the end of the range it was searched for in
+func (t idTable) search(id []byte) (uint32, uint32) {
+	lo, hi := t.fanoutRange(id[0])
+
+	n := lo + uint32(sort.Search(int(hi-lo), func(i int) bool {
+		return bytes.Compare(t.idAt(lo+uint32(i)), id) >= 0
+	}))
+
+	return n, hi
+}
+
+// Return the position of id in the table, if it's there
+func (t idTable) find(id []byte) (uint32, bool) {
+	n, hi := t.search(id)
+
+	if n < hi && bytes.Equal(t.idAt(n), id) {
+		return n, true
+	}
+
+	return 0, false
+}
+
+// Return the ids in the table that begin with prefix. The prefix
+// must be at least 2 hex digits long.
+func (t idTable) findPrefix(prefix string) ([]string, error) {
+	// Pad an odd length prefix so that it decodes to the lowest id
+	// it could match.
+	low, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2))
+	if err != nil {
+		return nil, err
+	}
+
+	first, hi := t.search(low)
+
+	var ids []string
+
+	for n := first; n < hi; n++ {
+		id := hex.EncodeToString(t.idAt(n))
+		if !strings.HasPrefix(id, prefix) {
+			break
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,96 @@
+package gitreader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeIdTable(ids []string) idTable {
+	var raw [][]byte
+
+	for _, id := range ids {
+		b, _ := hex.DecodeString(id)
+		raw = append(raw, b)
+	}
+
+	fanout := make([]byte, 1024)
+
+	for i := 0; i < 256; i++ {
+		var cnt uint32
+		for _, id := range raw {
+			if int(id[0]) <= i {
+				cnt++
+			}
+		}
+
+		order.PutUint32(fanout[4*i:], cnt)
+	}
+
+	return idTable{
+		fanout: fanout,
+		idAt:   func(n uint32) []byte { return raw[n] },
+		count:  uint32(len(raw)),
+	}
+}
+
+func TestIdTableFind(t *testing.T) {
+	ids := []string{
+		"1111111111111111111111111111111111111111",
+		"1122222222222222222222222222222222222222",
+		"ff00000000000000000000000000000000000000",
+	}
+
+	table := makeIdTable(ids)
+
+	for i, id := range ids {
+		b, _ := hex.DecodeString(id)
+
+		n, ok := table.find(b)
+		require.True(t, ok)
+
+		assert.Equal(t, uint32(i), n)
+	}
+
+	_, ok := table.find(bytes.Repeat([]byte{0x11}, 19))
+	assert.False(t, ok)
+
+	_, ok = table.find(bytes.Repeat([]byte{0x22}, 20))
+	assert.False(t, ok)
+}
+
+func TestIdTableFindPrefix(t *testing.T) {
+	table := makeIdTable([]string{
+		"1111111111111111111111111111111111111111",
+		"1122222222222222222222222222222222222222",
+		"1200000000000000000000000000000000000000",
+	})
+
+	ids, err := table.findPrefix("11")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1111111111111111111111111111111111111111", "1122222222222222222222222222222222222222"}, ids)
+
+	ids, err = table.findPrefix("112")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1122222222222222222222222222222222222222"}, ids)
+
+	ids, err = table.findPrefix("13")
+	require.NoError(t, err)
+
+	assert.Empty(t, ids)
+}
+
+func TestIdTableBadFanout(t *testing.T) {
+	table := makeIdTable([]string{"1111111111111111111111111111111111111111"})
+
+	// A fan-out table that claims more ids than there are
+	order.PutUint32(table.fanout[4*0x11:], 5)
+
+	_, ok := table.find(bytes.Repeat([]byte{0x11}, 20))
+	assert.False(t, ok)
+}
@@ -1,17 +1,46 @@
 package gitreader
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Implements reading objects out of the .git/objects directory
 type LooseObject struct {
 	Base string
+
+	// The objects directory to read from. If empty, Base/objects
+	// is used.
+	Objects string
+
+	// The hash the objects are named with. If nil, SHA1 is used.
+	Format *ObjectFormat
+}
+
+func (l *LooseObject) format() *ObjectFormat {
+	if l.Format != nil {
+		return l.Format
+	}
+
+	return SHA1
+}
+
+func (l *LooseObject) dir() string {
+	if l.Objects != "" {
+		return l.Objects
+	}
+
+	return filepath.Join(l.Base, "objects")
 }
 
 func (l *LooseObject) LoadObject(id string) (*Object, error) {
-	path := filepath.Join(l.Base, "objects", id[:2], id[2:])
+	if len(id) != l.format().HexSize() {
+		return nil, ErrNotExist
+	}
+
+	path := filepath.Join(l.dir(), id[:2], id[2:])
 
 	f, err := os.Open(path)
 	if err != nil {
@@ -21,9 +50,40 @@ func (l *LooseObject) LoadObject(id string) (*Object, error) {
 		return nil, err
 	}
 
-	return ParseObject(f)
+	obj, err := ParseObject(f)
+	if err != nil {
+		return nil, err
+	}
+
+	obj.hashSize = l.format().Size
+
+	return obj, nil
 }
 
 func (l *LooseObject) Close() error {
 	return nil
 }
+
+// Return the ids of all loose objects that begin with prefix.
+// The prefix must be at least 2 hex digits long.
+func (l *LooseObject) FindPrefix(prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(l.dir(), prefix[:2]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var ids []string
+
+	for _, file := range files {
+		id := prefix[:2] + file.Name()
+		if len(id) == l.format().HexSize() && strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
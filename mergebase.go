@@ -0,0 +1,295 @@
+package gitreader
+
+import (
+	"container/heap"
+	"errors"
+)
+
+var ErrNoMergeBase = errors.New("no merge base")
+
+// Resolve rev to the id of a commit, peeling tags
+func (r *Repo) resolveCommit(rev string) (string, error) {
+	id, err := r.RevParse(rev)
+	if err != nil {
+		return "", err
+	}
+
+	return r.peelTo(id, "commit")
+}
+
+func (r *Repo) resolveCommits(revs []string) ([]string, error) {
+	ids := make([]string, len(revs))
+
+	for i, rev := range revs {
+		id, err := r.resolveCommit(rev)
+		if err != nil {
+			return nil, err
+		}
+
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+// Report whether the commit named by ancestor can be reached from
+// the one named by descendant. A commit is its own ancestor.
+func (r *Repo) IsAncestor(ancestor, descendant string) (bool, error) {
+	ids, err := r.resolveCommits([]string{ancestor, descendant})
+	if err != nil {
+		return false, err
+	}
+
+	return r.isAncestor(ids[0], ids[1])
+}
+
+// Return the best common ancestor of the commit one and a merge of
+// others, like git merge-base. When there is more than one equally
+// good answer, the newest is returned. Returns ErrNoMergeBase when
+// the histories are unrelated.
+func (r *Repo) MergeBase(one string, others ...string) (string, error) {
+	bases, err := r.MergeBaseAll(one, others...)
+	if err != nil {
+		return "", err
+	}
+
+	return bases[0], nil
+}
+
+// Return every best common ancestor of one and a merge of others,
+// newest first, like git merge-base --all
+func (r *Repo) MergeBaseAll(one string, others ...string) ([]string, error) {
+	ids, err := r.resolveCommits(append([]string{one}, others...))
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := r.mergeBases(ids[0], ids[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bases) == 0 {
+		return nil, ErrNoMergeBase
+	}
+
+	return bases, nil
+}
+
+// Return the best common ancestors of all of revs, as needed for an
+// octopus merge of them, like git merge-base --octopus --all
+func (r *Repo) MergeBaseOctopus(revs ...string) ([]string, error) {
+	ids, err := r.resolveCommits(revs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, ErrNoMergeBase
+	}
+
+	bases := ids[:1]
+
+	for _, id := range ids[1:] {
+		var next []string
+		seen := make(map[string]bool)
+
+		for _, base := range bases {
+			found, err := r.mergeBases(base, []string{id})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, b := range found {
+				if !seen[b] {
+					seen[b] = true
+					next = append(next, b)
+				}
+			}
+		}
+
+		if len(next) == 0 {
+			return nil, ErrNoMergeBase
+		}
+
+		bases = next
+	}
+
+	// The bases found for different bases of the round before can be
+	// ancestors of each other. Drop those, as git's reduce_heads does.
+	return r.removeRedundant(bases)
+}
+
+type paintFlags uint8
+
+const (
+	paintOne paintFlags = 1 << iota
+	paintTwo
+	paintStale
+	paintResult
+)
+
+// Walk down from one and twos in date order, painting each commit
+// with which side it's reachable from, until only commits reachable
+// from both sides are left. Returns the commits found to be reachable
+// from both, newest first, and the paint of every commit visited.
+// This is how git's paint_down_to_common works. If oneOnly is set,
+// the walk ends as soon as one itself is found from twos, and
+// commits whose generation number shows they can't reach one aren't
+// walked.
+func (r *Repo) paintDown(one string, twos []string, oneOnly bool) ([]string, map[string]paintFlags, error) {
+	flags := make(map[string]paintFlags)
+	queue := &commitQueue{}
+
+	var minGeneration uint64
+
+	push := func(id string, paint paintFlags) error {
+		next, err := r.walkCommit(id)
+		if err != nil {
+			return err
+		}
+
+		flags[id] |= paint
+
+		// An ancestor of one has a lower generation than one
+		if next.generation != 0 && next.generation < minGeneration {
+			return nil
+		}
+
+		heap.Push(queue, next)
+
+		return nil
+	}
+
+	if err := push(one, paintOne); err != nil {
+		return nil, nil, err
+	}
+
+	if oneOnly {
+		minGeneration = queue.items[0].generation
+	}
+
+	for _, two := range twos {
+		if err := push(two, paintTwo); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var results []string
+
+	for queueHasNonStale(queue, flags) {
+		next := heap.Pop(queue).(*queuedCommit)
+
+		paint := flags[next.id] & (paintOne | paintTwo | paintStale)
+
+		if paint == paintOne|paintTwo {
+			if flags[next.id]&paintResult == 0 {
+				flags[next.id] |= paintResult
+				results = append(results, next.id)
+			}
+
+			if oneOnly && next.id == one {
+				break
+			}
+
+			// Anything below a common commit is no longer interesting
+			paint |= paintStale
+		}
+
+		for _, parent := range next.parents {
+			if flags[parent]&paint == paint {
+				continue
+			}
+
+			if err := push(parent, paint); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return results, flags, nil
+}
+
+func queueHasNonStale(queue *commitQueue, flags map[string]paintFlags) bool {
+	for _, item := range queue.items {
+		if flags[item.id]&paintStale == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the best common ancestors of one and any of twos, newest
+// first. There can be more than one when history criss-crosses.
+func (r *Repo) mergeBases(one string, twos []string) ([]string, error) {
+	for _, two := range twos {
+		if two == one {
+			return []string{one}, nil
+		}
+	}
+
+	results, flags, err := r.paintDown(one, twos, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results found before a newer result reached them aren't best
+	var bases []string
+	for _, id := range results {
+		if flags[id]&paintStale == 0 {
+			bases = append(bases, id)
+		}
+	}
+
+	if len(bases) <= 1 {
+		return bases, nil
+	}
+
+	return r.removeRedundant(bases)
+}
+
+// Report whether ancestor can be reached from descendant
+func (r *Repo) isAncestor(ancestor, descendant string) (bool, error) {
+	if ancestor == descendant {
+		return true, nil
+	}
+
+	_, flags, err := r.paintDown(ancestor, []string{descendant}, true)
+	if err != nil {
+		return false, err
+	}
+
+	return flags[ancestor]&paintTwo != 0, nil
+}
+
+// Drop any of ids that is an ancestor of another
+func (r *Repo) removeRedundant(ids []string) ([]string, error) {
+	var kept []string
+
+	for i, id := range ids {
+		redundant := false
+
+		for j, other := range ids {
+			if i == j {
+				continue
+			}
+
+			ok, err := r.isAncestor(id, other)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				redundant = true
+				break
+			}
+		}
+
+		if !redundant {
+			kept = append(kept, id)
+		}
+	}
+
+	return kept, nil
+}
@@ -0,0 +1,111 @@
+package gitreader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeBases(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	bases, err := repo.mergeBases("58093088d2e26942d54605d42502d23d24e3fa21", []string{"631e210f6c96c52bc169da6cde79eeccf2b25133"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"f8ed0f8d65e62019f40b9e74ffb830016bb98088"}, bases)
+
+	ok, err := repo.isAncestor("ea1410f0a4d4d8bfd5e7e091d482c9612eb316e9", "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = repo.isAncestor("c9a5789da1613be93d0eaba9a2cb7fb6c3b59f06", "7d4990f38518569153e837970474000ac532def5")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestIsAncestor(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	tests := []struct {
+		ancestor, descendant string
+		ok                   bool
+	}{
+		{"v0.1", "main", true},
+		{"feature", "main", true},
+		{"main", "main", true},
+		{"main", "v0.1", false},
+		{"topic-a", "topic-b", false},
+		{"c9a5789", "feature", false},
+	}
+
+	for _, test := range tests {
+		ok, err := repo.IsAncestor(test.ancestor, test.descendant)
+		require.NoError(t, err)
+
+		assert.Equal(t, test.ok, ok, test.ancestor+" "+test.descendant)
+	}
+
+	_, err := repo.IsAncestor("v1.0^{tree}", "main")
+	assert.Equal(t, ErrNotCommit, err)
+}
+
+func TestMergeBase(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	base, err := repo.MergeBase("topic-a", "topic-b")
+	require.NoError(t, err)
+	assert.Equal(t, "f8ed0f8d65e62019f40b9e74ffb830016bb98088", base)
+
+	base, err = repo.MergeBase("feature", "stable~1")
+	require.NoError(t, err)
+	assert.Equal(t, "2a6239aef5a6073d9030e99ce84030a0f32470b9", base)
+
+	// The merge base of topic-a and a merge of topic-b and feature
+	base, err = repo.MergeBase("topic-a", "topic-b", "feature")
+	require.NoError(t, err)
+	assert.Equal(t, "f8ed0f8d65e62019f40b9e74ffb830016bb98088", base)
+
+	bases, err := repo.MergeBaseOctopus("topic-a", "topic-b", "feature")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7d4990f38518569153e837970474000ac532def5"}, bases)
+}
+
+func TestMergeBaseCrissCross(t *testing.T) {
+	repo, err := OpenRepo("fixtures/crisscross.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	// x and y each merged the other's first commit
+	bases, err := repo.MergeBaseAll("x", "y")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"508f40bd627612a8f04d30f4292b223c0286f1d9",
+		"d59c1bd4bf20b49ee4ddb6b654861b956aeaa73e",
+	}, bases)
+
+	base, err := repo.MergeBase("x", "y")
+	require.NoError(t, err)
+	assert.Equal(t, "508f40bd627612a8f04d30f4292b223c0286f1d9", base)
+
+	bases, err = repo.MergeBaseOctopus("x", "y", "main")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5dcb52128fdd502fa53a966d25fc1930bd2c8240"}, bases)
+
+	// 5dcb521 is found too, but it's an ancestor of d59c1bd
+	bases, err = repo.MergeBaseOctopus("x", "y", "x1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d59c1bd4bf20b49ee4ddb6b654861b956aeaa73e"}, bases)
+
+	_, err = repo.MergeBase("x", "lonely")
+	assert.Equal(t, ErrNoMergeBase, err)
+
+	ok, err := repo.IsAncestor("lonely", "x")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
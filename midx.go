@@ -0,0 +1,232 @@
+package gitreader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+var ErrBadMultiPackIndex = errors.New("bad multi-pack-index format")
+
+const midxHeader = "MIDX"
+
+const (
+	_CHUNK_PACK_NAMES    = 0x504e414d // PNAM
+	_CHUNK_OID_FANOUT    = 0x4f494446 // OIDF
+	_CHUNK_OID_LOOKUP    = 0x4f49444c // OIDL
+	_CHUNK_OBJECT_OFFSET = 0x4f4f4646 // OOFF
+	_CHUNK_LARGE_OFFSET  = 0x4c4f4646 // LOFF
+)
+
+// Implements LoadObject using objects/pack/multi-pack-index, which
+// lists the objects of many packs in a single sorted table so that
+// finding one takes a single binary search.
+type MultiPackIndex struct {
+	// The names of the .idx files of the packs covered by the index
+	PackNames []string
+
+	path   string
+	file   *os.File
+	data   mmap.MMap
+	packs  []*Pack
+	format *ObjectFormat
+
+	count        uint32
+	fanout       []byte
+	oids         []byte
+	offsets      []byte
+	largeOffsets []byte
+}
+
+// Load the multi-pack-index in dir, usually objects/pack, along
+// with every pack it covers
+func LoadMultiPackIndex(dir string) (*MultiPackIndex, error) {
+	m := &MultiPackIndex{path: filepath.Join(dir, "multi-pack-index")}
+
+	err := m.load()
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	for _, name := range m.PackNames {
+		pack, err := LoadPackFormat(filepath.Join(dir, strings.TrimSuffix(name, ".idx")), m.format)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+
+		m.packs = append(m.packs, pack)
+	}
+
+	return m, nil
+}
+
+func (m *MultiPackIndex) load() error {
+	var err error
+	m.file, err = os.Open(m.path)
+	if err != nil {
+		return err
+	}
+
+	m.data, err = mmap.Map(m.file, mmap.RDONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	// signature, version, hash version, chunk count, base count,
+	// pack count
+	if len(m.data) < 12 || string([]byte(m.data[:4])) != midxHeader || m.data[4] != 1 {
+		return ErrBadMultiPackIndex
+	}
+
+	switch m.data[5] {
+	case 1:
+		m.format = SHA1
+	case 2:
+		m.format = SHA256
+	default:
+		return ErrBadMultiPackIndex
+	}
+
+	chunks, err := readChunks(m.data, 12, int(m.data[6]))
+	if err != nil {
+		return ErrBadMultiPackIndex
+	}
+
+	m.fanout = chunks[_CHUNK_OID_FANOUT]
+	m.oids = chunks[_CHUNK_OID_LOOKUP]
+	m.offsets = chunks[_CHUNK_OBJECT_OFFSET]
+	m.largeOffsets = chunks[_CHUNK_LARGE_OFFSET]
+
+	if len(m.fanout) != 1024 {
+		return ErrBadMultiPackIndex
+	}
+
+	m.count = order.Uint32(m.fanout[1020:])
+
+	if len(m.oids) < m.format.Size*int(m.count) || len(m.offsets) < 8*int(m.count) {
+		return ErrBadMultiPackIndex
+	}
+
+	numPacks := int(order.Uint32(m.data[8:]))
+
+	names := bytes.Split(chunks[_CHUNK_PACK_NAMES], []byte{0})
+	if len(names) < numPacks {
+		return ErrBadMultiPackIndex
+	}
+
+	for _, name := range names[:numPacks] {
+		m.PackNames = append(m.PackNames, string(name))
+	}
+
+	return nil
+}
+
+// Read a table of chunk ids and offsets, as used by the
+// multi-pack-index and commit-graph files, and return the contents
+// of each chunk keyed by id.
+func readChunks(data []byte, start, count int) (map[uint32][]byte, error) {
+	if len(data) < start+12*(count+1) {
+		return nil, ErrBadMultiPackIndex
+	}
+
+	chunks := make(map[uint32][]byte)
+
+	for i := 0; i < count; i++ {
+		entry := data[start+12*i:]
+
+		id := order.Uint32(entry)
+		begin := order.Uint64(entry[4:])
+		end := order.Uint64(entry[16:])
+
+		if begin > end || end > uint64(len(data)) {
+			return nil, ErrBadMultiPackIndex
+		}
+
+		chunks[id] = data[begin:end]
+	}
+
+	return chunks, nil
+}
+
+func (m *MultiPackIndex) Close() error {
+	for _, pack := range m.packs {
+		pack.Close()
+	}
+
+	if m.data != nil {
+		m.data.Unmap()
+	}
+
+	if m.file != nil {
+		return m.file.Close()
+	}
+
+	return nil
+}
+
+func (m *MultiPackIndex) idAt(n uint32) []byte {
+	size := uint32(m.format.Size)
+	return m.oids[size*n : size*n+size]
+}
+
+// The ids covered by the index, along with their fan-out table
+func (m *MultiPackIndex) ids() idTable {
+	return idTable{fanout: m.fanout, idAt: m.idAt, count: m.count}
+}
+
+// Find the pack holding id and the offset of the object in it
+func (m *MultiPackIndex) FindOffset(id string) (*Pack, uint64, error) {
+	idBytes, err := hex.DecodeString(id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(idBytes) != m.format.Size {
+		return nil, 0, ErrNotExist
+	}
+
+	n, ok := m.ids().find(idBytes)
+	if !ok {
+		return nil, 0, ErrNotExist
+	}
+
+	packId := order.Uint32(m.offsets[8*n:])
+	offset := uint64(order.Uint32(m.offsets[8*n+4:]))
+
+	if offset&0x80000000 != 0 {
+		idx := offset &^ 0x80000000
+		if uint64(len(m.largeOffsets)) < 8*idx+8 {
+			return nil, 0, ErrBadMultiPackIndex
+		}
+
+		offset = order.Uint64(m.largeOffsets[8*idx:])
+	}
+
+	if int(packId) >= len(m.packs) {
+		return nil, 0, ErrBadMultiPackIndex
+	}
+
+	return m.packs[packId], offset, nil
+}
+
+func (m *MultiPackIndex) LoadObject(id string) (*Object, error) {
+	pack, offset, err := m.FindOffset(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return pack.readObject(offset)
+}
+
+// Return the ids of all objects covered by the index that begin
+// with prefix. The prefix must be at least 2 hex digits long.
+func (m *MultiPackIndex) FindPrefix(prefix string) ([]string, error) {
+	return m.ids().findPrefix(prefix)
+}
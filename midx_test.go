@@ -0,0 +1,80 @@
+package gitreader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMultiPackIndex(t *testing.T) {
+	midx, err := LoadMultiPackIndex("fixtures/midx.git/objects/pack")
+	require.NoError(t, err)
+
+	defer midx.Close()
+
+	expected := []string{
+		"pack-e3abd85d339a6bbe056a33fcea3c0d49f246f765.idx",
+		"pack-eec18f8afd2142346ba682d5cadcc1e71b0f19e4.idx",
+	}
+
+	assert.Equal(t, expected, midx.PackNames)
+
+	// initial import, in the first pack
+	obj, err := midx.LoadObject("6672ee4b1f141d706319e7dd7c37c869ad9f8659")
+	require.NoError(t, err)
+
+	assert.Equal(t, "commit", obj.Type)
+
+	// the feature merge, in the second pack
+	obj, err = midx.LoadObject("f8ed0f8d65e62019f40b9e74ffb830016bb98088")
+	require.NoError(t, err)
+
+	commit, err := obj.Commit()
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, len(commit.Parents))
+
+	// only in the pack that isn't covered
+	_, err = midx.LoadObject("cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8")
+	assert.Equal(t, ErrNotExist, err)
+
+	ids, err := midx.FindPrefix("6672e")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"6672ee4b1f141d706319e7dd7c37c869ad9f8659"}, ids)
+}
+
+func TestRepoMultiPackIndex(t *testing.T) {
+	repo, err := OpenRepo("fixtures/midx.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	var midx, packs int
+
+	for _, loader := range repo.Loaders {
+		switch loader.(type) {
+		case *MultiPackIndex:
+			midx++
+		case *Pack:
+			packs++
+		}
+	}
+
+	assert.Equal(t, 1, midx)
+	assert.Equal(t, 1, packs)
+
+	blob, err := repo.CatFile("v0.1", "src/util.go")
+	require.NoError(t, err)
+
+	data, err := blob.Bytes()
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "func join(")
+
+	id, err := repo.ResolveRef("HEAD~1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "ab168e9c53150ddf5fa1e36d899ecf7ad8e0bba5", id)
+}
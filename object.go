@@ -5,7 +5,6 @@ import (
 	"compress/zlib"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"strconv"
@@ -20,6 +19,9 @@ type Object struct {
 
 	input io.ReadCloser
 	body  *bufio.Reader
+
+	// The length in bytes of the ids in a tree. 0 means 20, for SHA-1.
+	hashSize int
 }
 
 // Cleanup the object's resources
@@ -61,6 +63,9 @@ func ParseObject(input io.Reader) (*Object, error) {
 	return obj, nil
 }
 
+// Read the next header line. Lines that begin with a space continue
+// the value of the previous header and are joined to it with newlines.
+// Returns empty strings once the blank line ending the headers is read.
 func (o *Object) readValue() (string, string, error) {
 	line, err := o.body.ReadString('\n')
 	if err != nil {
@@ -75,11 +80,50 @@ func (o *Object) readValue() (string, string, error) {
 
 	parts := strings.SplitN(line, " ", 2)
 
-	return parts[0], parts[1], nil
+	var value string
+	if len(parts) == 2 {
+		value = parts[1]
+	}
+
+	for {
+		next, err := o.body.Peek(1)
+		if err != nil || next[0] != ' ' {
+			break
+		}
+
+		cont, err := o.body.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", "", err
+		}
+
+		value += "\n" + strings.TrimSuffix(cont[1:], "\n")
+	}
+
+	return parts[0], value, nil
+}
+
+type Header struct {
+	Name, Value string
 }
 
 type Commit struct {
-	Parent, Tree, Author, Committer, Message string
+	Tree, Message string
+
+	Author, Committer Signature
+
+	// Parent ids, in the order they appear in the commit
+	Parents []string
+
+	// The value of the gpgsig header, if the commit is signed
+	Signature string
+
+	// The value of the encoding header. Empty means UTF-8.
+	Encoding string
+
+	// Every header besides tree, parent, author and committer, in
+	// the order they appear in the commit. This includes gpgsig,
+	// mergetag and encoding.
+	ExtraHeaders []Header
 }
 
 // Return the Object as a Commit
@@ -98,15 +142,22 @@ func (o *Object) Commit() (*Commit, error) {
 
 		switch kind {
 		case "parent":
-			com.Parent = data
+			com.Parents = append(com.Parents, data)
 		case "tree":
 			com.Tree = data
 		case "author":
-			com.Author = data
+			com.Author = ParseSignature(data)
 		case "committer":
-			com.Committer = data
+			com.Committer = ParseSignature(data)
 		default:
-			return nil, fmt.Errorf("Unknown value: %s", kind)
+			switch kind {
+			case "gpgsig", "gpgsig-sha256":
+				com.Signature = data
+			case "encoding":
+				com.Encoding = data
+			}
+
+			com.ExtraHeaders = append(com.ExtraHeaders, Header{kind, data})
 		}
 	}
 
@@ -120,6 +171,78 @@ func (o *Object) Commit() (*Commit, error) {
 	return com, nil
 }
 
+type Tag struct {
+	Object, Type, Tag, Message, Signature string
+
+	Tagger Signature
+
+	// Every header besides object, type, tag and tagger, in the order
+	// they appear in the tag
+	ExtraHeaders []Header
+}
+
+// The armor lines that mark the start of a signature appended
+// to a tag message
+var signatureHeaders = []string{
+	"-----BEGIN PGP SIGNATURE-----",
+	"-----BEGIN PGP MESSAGE-----",
+	"-----BEGIN SSH SIGNATURE-----",
+	"-----BEGIN SIGNED MESSAGE-----",
+}
+
+// Split a trailing signature off of msg
+func splitSignature(msg string) (string, string) {
+	for _, hdr := range signatureHeaders {
+		if strings.HasPrefix(msg, hdr) {
+			return "", msg
+		}
+
+		if idx := strings.LastIndex(msg, "\n"+hdr); idx != -1 {
+			return msg[:idx+1], msg[idx+1:]
+		}
+	}
+
+	return msg, ""
+}
+
+// Return the Object as a Tag
+func (o *Object) Tag() (*Tag, error) {
+	tag := &Tag{}
+
+	for {
+		kind, data, err := o.readValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if kind == "" {
+			break
+		}
+
+		switch kind {
+		case "object":
+			tag.Object = data
+		case "type":
+			tag.Type = data
+		case "tag":
+			tag.Tag = data
+		case "tagger":
+			tag.Tagger = ParseSignature(data)
+		default:
+			tag.ExtraHeaders = append(tag.ExtraHeaders, Header{kind, data})
+		}
+	}
+
+	data, err := ioutil.ReadAll(o.body)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.Message, tag.Signature = splitSignature(string(data))
+
+	return tag, nil
+}
+
 type Tree struct {
 	Entries map[string]*Entry
 }
@@ -134,7 +257,12 @@ func (o *Object) Tree() (*Tree, error) {
 		Entries: make(map[string]*Entry),
 	}
 
-	idbytes := make([]byte, 20)
+	hashSize := o.hashSize
+	if hashSize == 0 {
+		hashSize = SHA1.Size
+	}
+
+	idbytes := make([]byte, hashSize)
 
 	for {
 		name, err := o.body.ReadString(0)
@@ -148,7 +276,7 @@ func (o *Object) Tree() (*Tree, error) {
 
 		parts := strings.SplitN(name[:len(name)-1], " ", 2)
 
-		_, err = o.body.Read(idbytes)
+		_, err = io.ReadFull(o.body, idbytes)
 		if err != nil {
 			return nil, err
 		}
@@ -162,7 +290,6 @@ func (o *Object) Tree() (*Tree, error) {
 		tree.Entries[entry.Name] = entry
 	}
 
-	return nil, nil
 }
 
 type Blob struct {
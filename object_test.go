@@ -28,13 +28,85 @@ func TestParseCommitObject(t *testing.T) {
 	commit, err := obj.Commit()
 	require.NoError(t, err)
 
-	assert.Equal(t, "abcd", commit.Parent)
+	assert.Equal(t, []string{"abcd"}, commit.Parents)
 	assert.Equal(t, "b28f66668670da36a8618360d1f16f3415dfaa3f", commit.Tree)
-	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539320 -0800", commit.Author)
-	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539320 -0800", commit.Committer)
+	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539320 -0800", commit.Author.String())
+	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539320 -0800", commit.Committer.String())
+	assert.Equal(t, "Evan Phoenix", commit.Author.Name)
+	assert.Equal(t, "evan@phx.io", commit.Author.Email)
+	assert.Equal(t, int64(1418539320), commit.Author.When.Unix())
 	assert.Equal(t, "add Procfile\n", commit.Message)
 }
 
+func TestParseMergeCommitObject(t *testing.T) {
+	plain := []byte("commit 203\x00tree b28f66668670da36a8618360d1f16f3415dfaa3f\nparent abcd\nparent ef01\nparent 2345\nauthor Evan Phoenix <evan@phx.io> 1418539320 -0800\ncommitter Evan Phoenix <evan@phx.io> 1418539320 -0800\n\nmerge branches\n")
+
+	var compress bytes.Buffer
+
+	zw := zlib.NewWriter(&compress)
+	zw.Write(plain)
+	zw.Close()
+
+	obj, err := ParseObject(&compress)
+	require.NoError(t, err)
+
+	commit, err := obj.Commit()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"abcd", "ef01", "2345"}, commit.Parents)
+	assert.Equal(t, "merge branches\n", commit.Message)
+}
+
+func TestParseCommitObjectExtraHeaders(t *testing.T) {
+	plain := []byte("commit 361\x00tree b28f66668670da36a8618360d1f16f3415dfaa3f\nparent abcd\nauthor Evan Phoenix <evan@phx.io> 1418539320 -0800\ncommitter Evan Phoenix <evan@phx.io> 1418539320 -0800\nencoding ISO-8859-1\nmergetag object ef01\n type commit\n tag v1.0\n \n Release 1.0\nx-future value\ngpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAd\n =abcd\n -----END PGP SIGNATURE-----\n\nsigned commit\n")
+
+	var compress bytes.Buffer
+
+	zw := zlib.NewWriter(&compress)
+	zw.Write(plain)
+	zw.Close()
+
+	obj, err := ParseObject(&compress)
+	require.NoError(t, err)
+
+	commit, err := obj.Commit()
+	require.NoError(t, err)
+
+	sig := "-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAd\n=abcd\n-----END PGP SIGNATURE-----"
+
+	assert.Equal(t, []string{"abcd"}, commit.Parents)
+	assert.Equal(t, "ISO-8859-1", commit.Encoding)
+	assert.Equal(t, sig, commit.Signature)
+	assert.Equal(t, "signed commit\n", commit.Message)
+
+	expected := []Header{
+		{"encoding", "ISO-8859-1"},
+		{"mergetag", "object ef01\ntype commit\ntag v1.0\n\nRelease 1.0"},
+		{"x-future", "value"},
+		{"gpgsig", sig},
+	}
+
+	assert.Equal(t, expected, commit.ExtraHeaders)
+}
+
+func TestParseRootCommitObject(t *testing.T) {
+	plain := []byte("commit 153\x00tree b28f66668670da36a8618360d1f16f3415dfaa3f\nauthor Evan Phoenix <evan@phx.io> 1418539320 -0800\ncommitter Evan Phoenix <evan@phx.io> 1418539320 -0800\n\nadd Procfile\n")
+
+	var compress bytes.Buffer
+
+	zw := zlib.NewWriter(&compress)
+	zw.Write(plain)
+	zw.Close()
+
+	obj, err := ParseObject(&compress)
+	require.NoError(t, err)
+
+	commit, err := obj.Commit()
+	require.NoError(t, err)
+
+	assert.Empty(t, commit.Parents)
+}
+
 func TestParseTreeObject(t *testing.T) {
 	plain := []byte("tree 36\x00100644 Procfile\x00^\x7FE{\xB1s/C\x15\xF3\xB6\x19>\xE8^\xFD\xF7s]P")
 
@@ -84,3 +156,48 @@ func TestParseBlobObject(t *testing.T) {
 
 	assert.Equal(t, []byte("web: puma\n"), blob)
 }
+
+func TestParseTagObject(t *testing.T) {
+	plain := []byte("tag 217\x00object 3e15650095622b50da9e805b2d0550b5961512c9\ntype commit\ntag v1.0-signed\ntagger Evan Phoenix <evan@phx.io> 1418539400 -0800\n\nSigned 1.0\n-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAd\n=abcd\n-----END PGP SIGNATURE-----\n")
+
+	var compress bytes.Buffer
+
+	zw := zlib.NewWriter(&compress)
+	zw.Write(plain)
+	zw.Close()
+
+	obj, err := ParseObject(&compress)
+	require.NoError(t, err)
+
+	assert.Equal(t, "tag", obj.Type)
+
+	tag, err := obj.Tag()
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", tag.Object)
+	assert.Equal(t, "commit", tag.Type)
+	assert.Equal(t, "v1.0-signed", tag.Tag)
+	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539400 -0800", tag.Tagger.String())
+	assert.Equal(t, "Signed 1.0\n", tag.Message)
+	assert.Equal(t, "-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAd\n=abcd\n-----END PGP SIGNATURE-----\n", tag.Signature)
+}
+
+func TestParseTagObjectExtraHeaders(t *testing.T) {
+	plain := []byte("tag 178\x00object 3e15650095622b50da9e805b2d0550b5961512c9\ntype commit\ntag v1.0\ntagger Evan Phoenix <evan@phx.io> 1418539400 -0800\ngpgsig-sha256 -----BEGIN PGP SIGNATURE-----\n abcd\n\nTagged\n")
+
+	var compress bytes.Buffer
+
+	zw := zlib.NewWriter(&compress)
+	zw.Write(plain)
+	zw.Close()
+
+	obj, err := ParseObject(&compress)
+	require.NoError(t, err)
+
+	tag, err := obj.Tag()
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", tag.Object)
+	assert.Equal(t, "Tagged\n", tag.Message)
+	assert.Equal(t, []Header{{"gpgsig-sha256", "-----BEGIN PGP SIGNATURE-----\nabcd"}}, tag.ExtraHeaders)
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"math/bits"
 	"os"
 
 	"github.com/edsrzf/mmap-go"
@@ -18,9 +19,16 @@ import (
 
 // Load the pack data from the given path
 func LoadPack(path string) (*Pack, error) {
+	return LoadPackFormat(path, SHA1)
+}
+
+// Load the pack data from the given path, for a repo whose objects
+// are named using format
+func LoadPackFormat(path string, format *ObjectFormat) (*Pack, error) {
 	pack := &Pack{
 		idxPath:  path + ".idx",
 		dataPath: path + ".pack",
+		format:   format,
 	}
 
 	err := pack.loadIndex()
@@ -44,11 +52,30 @@ type Pack struct {
 	indexFile *os.File
 	index     mmap.MMap
 
+	// Either 1 or 2, the two layouts of .idx files
+	indexVersion int
+
+	// The hash used for the ids in the index and in REF_DELTAs. If
+	// nil, SHA1 is used.
+	format *ObjectFormat
+
 	dataPath string
 	dataFile *os.File
 	data     mmap.MMap
 }
 
+func (p *Pack) objectFormat() *ObjectFormat {
+	if p.format != nil {
+		return p.format
+	}
+
+	return SHA1
+}
+
+func (p *Pack) hashSize() int {
+	return p.objectFormat().Size
+}
+
 func (p *Pack) Close() error {
 	p.index.Unmap()
 	p.indexFile.Close()
@@ -61,6 +88,10 @@ var ErrBadPack = errors.New("bad pack format")
 
 const indexHeader = "\xFF\x74\x4F\x63\x00\x00\x00\x02"
 
+// Version 2 and later indexes start with this. Version 1 indexes
+// have no header, and start straight away with the fan-out table.
+const indexMagic = "\xFF\x74\x4F\x63"
+
 func (p *Pack) loadIndex() error {
 	var err error
 	p.indexFile, err = os.Open(p.idxPath)
@@ -73,7 +104,16 @@ func (p *Pack) loadIndex() error {
 		return err
 	}
 
-	if string([]byte(p.index[:8])) != indexHeader {
+	if len(p.index) < 1032 {
+		return ErrBadIndex
+	}
+
+	switch {
+	case string([]byte(p.index[:8])) == indexHeader:
+		p.indexVersion = 2
+	case string([]byte(p.index[:4])) != indexMagic:
+		p.indexVersion = 1
+	default:
 		return ErrBadIndex
 	}
 
@@ -113,44 +153,85 @@ const (
 
 var ErrNotFound = errors.New("object not found")
 
-func (p *Pack) FindOffset(id string) (uint32, error) {
+func (p *Pack) FindOffset(id string) (uint64, error) {
 	idBytes, err := hex.DecodeString(id)
 	if err != nil {
 		return 0, err
 	}
 
-	// 255 uint32s
-	fan := p.index[8:1032]
-	size := order.Uint32(fan[1020:])
+	if len(idBytes) != p.hashSize() {
+		return 0, ErrNotExist
+	}
 
-	// TODO: Make sure fan[id[0]] > fan[id[0] - 1]
-	//       Otherwise our object's definitely not here
-	cnt := order.Uint32(fan[4*id[0]:])
+	n, ok := p.ids().find(idBytes)
+	if !ok {
+		return 0, ErrNotExist
+	}
 
-	loc := 8 + 1024 + cnt*20
-	suspect := p.index[loc : loc+20]
-	cmp := bytes.Compare(idBytes, suspect)
+	return p.offsetAt(n)
+}
 
-	for lo, hi := uint32(0), size; cmp != 0; cmp = bytes.Compare(idBytes, suspect) {
-		if cmp < 0 {
-			hi = cnt
-		} else {
-			lo = cnt + 1
-		}
-		if lo >= hi {
-			return 0, ErrNotExist
+// The ids in the index, along with their fan-out table
+func (p *Pack) ids() idTable {
+	fan := p.index[p.fanBase() : p.fanBase()+1024]
+	return idTable{fanout: fan, idAt: p.idAt, count: order.Uint32(fan[1020:])}
+}
+
+func (p *Pack) fanBase() int {
+	if p.indexVersion == 1 {
+		return 0
+	}
+
+	return 8
+}
+
+// Return the pack offset of the n'th object in the index
+func (p *Pack) offsetAt(n uint32) (uint64, error) {
+	hashSize := uint64(p.hashSize())
+
+	// Version 1 stores each offset alongside its id
+	if p.indexVersion == 1 {
+		return uint64(order.Uint32(p.index[1024+(4+hashSize)*uint64(n):])), nil
+	}
+
+	size := uint64(order.Uint32(p.index[1028:]))
+
+	offsetBase := 1032 + hashSize*size + 4*size
+	offset := order.Uint32(p.index[offsetBase+4*uint64(n):])
+
+	// Packs over 2GiB store large offsets in a separate table of
+	// uint64s, indexed by the low 31 bits of the small offset.
+	if offset&0x80000000 != 0 {
+		largeBase := offsetBase + 4*size
+		idx := uint64(offset &^ 0x80000000)
+
+		if uint64(len(p.index)) < largeBase+8*idx+8 {
+			return 0, ErrBadIndex
 		}
-		cnt = (lo + hi) / 2
-		loc = 8 + 1024 + cnt*20
-		suspect = p.index[loc : loc+20]
+
+		return order.Uint64(p.index[largeBase+8*idx:]), nil
+	}
+
+	return uint64(offset), nil
+}
+
+// Return the ids of all objects in the pack that begin with prefix.
+// The prefix must be at least 2 hex digits long.
+func (p *Pack) FindPrefix(prefix string) ([]string, error) {
+	return p.ids().findPrefix(prefix)
+}
+
+// Return the id of the n'th object in the index
+func (p *Pack) idAt(n uint32) []byte {
+	hashSize := uint64(p.hashSize())
+
+	if p.indexVersion == 1 {
+		loc := 1024 + (4+hashSize)*uint64(n) + 4
+		return p.index[loc : loc+hashSize]
 	}
 
-	// TODO: check for 64-bit offset
-	// calculate which sha1 we looked at
-	n := (loc - 1032) / 20
-	offsetBase := 1032 + 20*size + 4*size
-	offset := order.Uint32(p.index[offsetBase+4*n:])
-	return offset, nil
+	loc := 1032 + hashSize*uint64(n)
+	return p.index[loc : loc+hashSize]
 }
 
 func (p *Pack) LoadObject(id string) (*Object, error) {
@@ -164,16 +245,17 @@ func (p *Pack) LoadObject(id string) (*Object, error) {
 
 var ErrUnknownType = errors.New("unknown type")
 
-func (p *Pack) readObject(offset uint32) (*Object, error) {
+func (p *Pack) readObject(offset uint64) (*Object, error) {
 	objType, objSize, rdr, err := p.readRaw(offset)
 	if err != nil {
 		return nil, err
 	}
 
 	obj := &Object{
-		Size:  objSize,
-		input: rdr,
-		body:  bufio.NewReader(rdr),
+		Size:     objSize,
+		input:    rdr,
+		body:     bufio.NewReader(rdr),
+		hashSize: p.hashSize(),
 	}
 
 	switch objType {
@@ -183,6 +265,8 @@ func (p *Pack) readObject(offset uint32) (*Object, error) {
 		obj.Type = "tree"
 	case _OBJ_BLOB:
 		obj.Type = "blob"
+	case _OBJ_TAG:
+		obj.Type = "tag"
 	default:
 		return nil, ErrUnknownType
 	}
@@ -192,58 +276,130 @@ func (p *Pack) readObject(offset uint32) (*Object, error) {
 
 var ErrBadDelta = errors.New("bad delta")
 
-func (p *Pack) readRaw(offset uint32) (int, uint64, io.ReadCloser, error) {
+// The header of an entry in the pack data
+type packEntry struct {
+	typ  int
+	size uint64
+
+	// The offset the compressed data starts at
+	data uint64
+
+	// Where the base of an _OBJ_OFS_DELTA is, or the id of the base
+	// of an _OBJ_REF_DELTA
+	baseOffset uint64
+	baseId     string
+}
+
+// Read the header of the entry at offset
+func (p *Pack) readEntry(offset uint64) (*packEntry, error) {
+	end := uint64(len(p.data))
+	if offset >= end {
+		return nil, ErrBadPack
+	}
+
 	objHeader := p.data[offset]
-	objType := int(objHeader & 0x71 >> 4)
 
-	// size when uncompressed
-	objSize := uint64(objHeader & 0x0F)
-	i := uint32(0)
-	shift := uint32(4)
+	entry := &packEntry{
+		typ: int(objHeader & 0x70 >> 4),
+
+		// size when uncompressed
+		size: uint64(objHeader & 0x0F),
+	}
+
+	i := offset + 1
+	shift := uint64(4)
 	for objHeader&0x80 != 0 {
+		if i >= end {
+			return nil, ErrBadPack
+		}
+
+		objHeader = p.data[i]
 		i++
-		objHeader = p.data[offset+i]
-		objSize |= uint64(objHeader&0x7F) << shift
+		entry.size |= uint64(objHeader&0x7F) << shift
 		shift += 7
 	}
 
-	var err error
-	var rawBase io.ReadCloser
+	switch entry.typ {
+	case _OBJ_OFS_DELTA:
+		if i >= end {
+			return nil, ErrBadPack
+		}
 
-	if objType == _OBJ_OFS_DELTA {
+		b := p.data[i]
 		i++
-		b := p.data[offset+i]
-		baseOffset := uint32(b & 0x7F)
+		baseOffset := uint64(b & 0x7F)
 		for b&0x80 != 0 {
+			if i >= end {
+				return nil, ErrBadPack
+			}
+
+			b = p.data[i]
 			i++
-			b = p.data[offset+i]
-			baseOffset = ((baseOffset + 1) << 7) | uint32(b&0x7F)
+			baseOffset = ((baseOffset + 1) << 7) | uint64(b&0x7F)
 		}
 
-		if baseOffset > uint32(len(p.data)) || baseOffset > offset {
-			return 0, 0, nil, ErrBadDelta
+		if baseOffset == 0 || baseOffset > offset {
+			return nil, ErrBadDelta
 		}
 
-		objType, objSize, rawBase, err = p.readRaw(offset - baseOffset)
+		entry.baseOffset = offset - baseOffset
+	case _OBJ_REF_DELTA:
+		hashSize := uint64(p.hashSize())
+		if i+hashSize > end {
+			return nil, ErrBadPack
+		}
+
+		entry.baseId = hex.EncodeToString(p.data[i : i+hashSize])
+		i += hashSize
+	}
+
+	entry.data = i
+
+	return entry, nil
+}
+
+// Git never writes delta chains longer than this. A longer one means
+// the pack is corrupt, most likely with REF_DELTAs that form a cycle.
+const maxDeltaDepth = 4095
+
+func (p *Pack) readRaw(offset uint64) (int, uint64, io.ReadCloser, error) {
+	return p.readRawDepth(offset, 0)
+}
+
+// Read the entry at offset, which is depth deltas down a chain
+func (p *Pack) readRawDepth(offset uint64, depth int) (int, uint64, io.ReadCloser, error) {
+	entry, err := p.readEntry(offset)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	objType, objSize := entry.typ, entry.size
+
+	var rawBase io.ReadCloser
+
+	if (objType == _OBJ_OFS_DELTA || objType == _OBJ_REF_DELTA) && depth >= maxDeltaDepth {
+		return 0, 0, nil, ErrBadDelta
+	}
+
+	if objType == _OBJ_OFS_DELTA {
+		objType, objSize, rawBase, err = p.readRawDepth(entry.baseOffset, depth+1)
 		if err != nil {
 			return 0, 0, nil, err
 		}
 
 	} else if objType == _OBJ_REF_DELTA {
-		baseId := hex.EncodeToString(p.data[offset+i+1 : offset+i+21])
-		i += 20
-		baseOffset, err := p.FindOffset(baseId)
+		baseOffset, err := p.FindOffset(entry.baseId)
 		if err != nil {
 			return 0, 0, nil, err
 		}
 
-		objType, objSize, rawBase, err = p.readRaw(baseOffset)
+		objType, objSize, rawBase, err = p.readRawDepth(baseOffset, depth+1)
 		if err != nil {
 			return 0, 0, nil, err
 		}
 	}
 
-	buf := bytes.NewReader(p.data[offset+i+1:])
+	buf := bytes.NewReader(p.data[entry.data:])
 	r, err := zlib.NewReader(buf)
 	if err != nil {
 		return 0, 0, nil, err
@@ -279,14 +435,17 @@ func applyDelta(base_r, patch_r io.ReadCloser) (io.ReadCloser, uint64, error) {
 		return nil, 0, err
 	}
 
-	// base length; TODO: use for bounds checking
 	baseLength, n := decodeVarint(patch)
-	if baseLength != uint64(len(base)) {
+	if n == 0 || baseLength != uint64(len(base)) {
 		return nil, 0, ErrBadDelta
 	}
 
 	patch = patch[n:]
 	resultLength, n := decodeVarint(patch)
+	if n == 0 {
+		return nil, 0, ErrBadDelta
+	}
+
 	patch = patch[n:]
 
 	result := make([]byte, resultLength)
@@ -300,12 +459,22 @@ func applyDelta(base_r, patch_r io.ReadCloser) (io.ReadCloser, uint64, error) {
 		} else if op&0x80 == 0 {
 			// insert
 			n := uint(op)
+			if i+n > uint(len(patch)) || n > uint(len(result[loc:])) {
+				return nil, 0, ErrBadDelta
+			}
+
 			copy(result[loc:], patch[i:i+n])
 			loc += n
 			patch = patch[i+n:]
 			continue
 		}
 
+		// Each set bit of the op is followed by a byte of the offset
+		// or length
+		if uint(len(patch)) < i+uint(bits.OnesCount8(op&0x7F)) {
+			return nil, 0, ErrBadDelta
+		}
+
 		copyOffset := uint(0)
 		for j := uint(0); j < 4; j++ {
 			if op&(1<<j) != 0 {
@@ -337,12 +506,22 @@ func applyDelta(base_r, patch_r io.ReadCloser) (io.ReadCloser, uint64, error) {
 		patch = patch[i:]
 	}
 
+	if uint64(loc) != resultLength {
+		return nil, 0, ErrBadDelta
+	}
+
 	return closableReader{bytes.NewReader(result)}, resultLength, nil
 }
 
+// Decode the size at the start of a delta. n is 0 if buf ends before
+// the size does.
 func decodeVarint(buf []byte) (x uint64, n int) {
 	shift := uint64(0)
 	for {
+		if n >= len(buf) {
+			return 0, 0
+		}
+
 		b := buf[n]
 		n++
 		x |= uint64(b&0x7F) << shift
@@ -351,5 +530,4 @@ func decodeVarint(buf []byte) (x uint64, n int) {
 			return
 		}
 	}
-	return
 }
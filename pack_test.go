@@ -1,11 +1,14 @@
 package gitreader
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"encoding/binary"
 	"encoding/hex"
 	"io"
 	"testing"
 
+	"github.com/edsrzf/mmap-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -37,7 +40,7 @@ func TestPackLoadObject(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, "b28f66668670da36a8618360d1f16f3415dfaa3f", commit.Tree)
-	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539320 -0800", commit.Author)
+	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539320 -0800", commit.Author.String())
 }
 
 func TestPackLoadDeltaObject(t *testing.T) {
@@ -67,3 +70,138 @@ func TestPackLoadDeltaObject(t *testing.T) {
 
 	assert.Equal(t, "a62edf8685920f7d5a95113020631cdebd18a185", hexSum)
 }
+
+func TestPackLoadTagObject(t *testing.T) {
+	pack, err := LoadPack("fixtures/pack-4208ea328daddcc832e430b3ba85aed9423742e9")
+	require.NoError(t, err)
+
+	id := "fdf5d07cb55e17f15299d19d5697ee99b6a31075"
+
+	object, err := pack.LoadObject(id)
+	require.NoError(t, err)
+
+	assert.Equal(t, "tag", object.Type)
+
+	tag, err := object.Tag()
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", tag.Object)
+	assert.Equal(t, "commit", tag.Type)
+	assert.Equal(t, "v1.0", tag.Tag)
+	assert.Equal(t, "Release 1.0\n", tag.Message)
+	assert.Equal(t, "", tag.Signature)
+}
+
+func TestPackFindPrefix(t *testing.T) {
+	pack, err := LoadPack("fixtures/pack-e59dc469beaf63d356b7ca488ca065536cb224f8")
+	require.NoError(t, err)
+
+	ids, err := pack.FindPrefix("3e1565")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"3e15650095622b50da9e805b2d0550b5961512c9"}, ids)
+
+	ids, err = pack.FindPrefix("ad5")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"ad5feb882f7aca152c5717d23e7582452a9f3ab3"}, ids)
+
+	ids, err = pack.FindPrefix("3e16")
+	require.NoError(t, err)
+
+	assert.Empty(t, ids)
+}
+
+func TestPackFindLargeOffset(t *testing.T) {
+	ids := [][]byte{
+		bytes.Repeat([]byte{0x11}, 20),
+		bytes.Repeat([]byte{0x22}, 20),
+	}
+
+	var idx bytes.Buffer
+
+	idx.WriteString(indexHeader)
+
+	for i := 0; i < 256; i++ {
+		var cnt uint32
+		for _, id := range ids {
+			if int(id[0]) <= i {
+				cnt++
+			}
+		}
+
+		binary.Write(&idx, order, cnt)
+	}
+
+	for _, id := range ids {
+		idx.Write(id)
+	}
+
+	// crc32s
+	idx.Write(make([]byte, 8))
+
+	binary.Write(&idx, order, uint32(12))
+	binary.Write(&idx, order, uint32(0x80000000))
+	binary.Write(&idx, order, uint64(0x123456789))
+
+	pack := &Pack{index: mmap.MMap(idx.Bytes()), indexVersion: 2}
+
+	offset, err := pack.FindOffset(hex.EncodeToString(ids[0]))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(12), offset)
+
+	offset, err = pack.FindOffset(hex.EncodeToString(ids[1]))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(0x123456789), offset)
+
+	// A large offset past the end of the table
+	order.PutUint32(pack.index[1032+2*20+8+4:], 0x80000001)
+
+	_, err = pack.FindOffset(hex.EncodeToString(ids[1]))
+	assert.Equal(t, ErrBadIndex, err)
+}
+
+func TestPackDeltaCycle(t *testing.T) {
+	// Two REF_DELTAs, each naming the other as its base
+	pack, err := LoadPack("fixtures/delta-cycle/pack-c7e3d51fd62cf19a5553164d5b00150946443967")
+	require.NoError(t, err)
+
+	defer pack.Close()
+
+	_, err = pack.LoadObject("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.Equal(t, ErrBadDelta, err)
+}
+
+func TestPackIndexV1(t *testing.T) {
+	pack, err := LoadPack("fixtures/idx-v1/pack-e59dc469beaf63d356b7ca488ca065536cb224f8")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, pack.indexVersion)
+
+	id := "3e15650095622b50da9e805b2d0550b5961512c9"
+
+	offset, err := pack.FindOffset(id)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(163), offset)
+
+	object, err := pack.LoadObject(id)
+	require.NoError(t, err)
+
+	assert.Equal(t, "commit", object.Type)
+
+	commit, err := object.Commit()
+	require.NoError(t, err)
+
+	assert.Equal(t, "b28f66668670da36a8618360d1f16f3415dfaa3f", commit.Tree)
+
+	_, err = pack.FindOffset("3e15650095622b50da9e805b2d0550b5961512c8")
+	assert.Equal(t, ErrNotExist, err)
+
+	ids, err := pack.FindPrefix("ad5f")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"ad5feb882f7aca152c5717d23e7582452a9f3ab3"}, ids)
+}
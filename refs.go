@@ -0,0 +1,307 @@
+package gitreader
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrBadPackedRefs = errors.New("bad packed-refs format")
+
+// An entry in the packed-refs file. Peeled is only set for
+// annotated tags, and holds the id of the object the tag
+// ultimately points to.
+type packedRef struct {
+	Name, Id, Peeled string
+}
+
+// Read the packed-refs file. A repo without one has no packed refs.
+func (r *Repo) readPackedRefs() ([]packedRef, error) {
+	f, err := os.Open(filepath.Join(r.commonDir(), "packed-refs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var refs []packedRef
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || line[0] == '#':
+			continue
+		case line[0] == '^':
+			if len(refs) == 0 {
+				return nil, ErrBadPackedRefs
+			}
+
+			refs[len(refs)-1].Peeled = line[1:]
+		default:
+			parts := strings.SplitN(line, " ", 2)
+			if len(parts) != 2 {
+				return nil, ErrBadPackedRefs
+			}
+
+			refs = append(refs, packedRef{Name: parts[1], Id: parts[0]})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// Look up a ref by its full name, such as refs/heads/master. A loose
+// ref takes precedence over one in packed-refs, as it does in git.
+// The bool result reports whether the ref was found at all.
+func (r *Repo) lookupRef(name string) (string, bool, error) {
+	return r.lookupRefDepth(name, 0)
+}
+
+// Look up a ref reached by following depth symbolic refs
+func (r *Repo) lookupRefDepth(name string, depth int) (string, bool, error) {
+	if name == "" {
+		return "", false, nil
+	}
+
+	id, err := r.resolveIndirect(r.refPath(name), depth)
+	if err == nil {
+		return id, true, nil
+	}
+
+	if _, isPe := err.(*os.PathError); !isPe {
+		return "", false, err
+	}
+
+	packed, err := r.readPackedRefs()
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, ref := range packed {
+		if ref.Name == name {
+			return ref.Id, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// A reference and what it points to
+type Ref struct {
+	// The full name, such as refs/heads/master
+	Name string
+
+	// The id of the object the ref points to
+	Id string
+
+	// For symbolic refs, the name of the ref this one points at
+	Target string
+
+	// For annotated tags, the id of the object at the end of
+	// the tag chain
+	Peeled string
+}
+
+// Return every ref whose name begins with prefix, sorted by name.
+// Use a prefix like "refs/heads/" or "refs/tags/" to list just
+// branches or tags, or "" to list everything.
+func (r *Repo) Refs(prefix string) ([]*Ref, error) {
+	return r.listRefs(prefix, nil)
+}
+
+// List the refs like Refs does. If broken is set, it's given the
+// name and error of each ref that can't be read, including
+// packed-refs itself, and the listing carries on without them.
+// Otherwise broken refs are skipped as git skips them, and any other
+// error ends the listing.
+func (r *Repo) listRefs(prefix string, broken func(name string, err error)) ([]*Ref, error) {
+	refs := make(map[string]*Ref)
+
+	packed, err := r.readPackedRefs()
+	if err != nil {
+		if broken == nil {
+			return nil, err
+		}
+
+		broken("packed-refs", err)
+	}
+
+	for _, ref := range packed {
+		if strings.HasPrefix(ref.Name, prefix) {
+			refs[ref.Name] = &Ref{Name: ref.Name, Id: ref.Id, Peeled: ref.Peeled}
+		}
+	}
+
+	bases := []string{r.commonDir()}
+	if r.Base != r.commonDir() {
+		bases = append(bases, r.Base)
+	}
+
+	for _, base := range bases {
+		err := r.walkLooseRefs(base, prefix, refs, broken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	list := make([]*Ref, len(names))
+	for i, name := range names {
+		list[i] = refs[name]
+	}
+
+	return list, nil
+}
+
+// Add the loose refs stored under base/refs to refs. Only refs that
+// actually belong in base are added, so a linked worktree's own
+// refs come from its directory and the rest from the common one.
+// Refs that can't be read are passed to broken, as for listRefs.
+func (r *Repo) walkLooseRefs(base, prefix string, refs map[string]*Ref, broken func(string, error)) error {
+	root := filepath.Join(base, "refs")
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+
+		if !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, ".lock") {
+			return nil
+		}
+
+		if r.refPath(name) != path {
+			return nil
+		}
+
+		ref, err := r.readLooseRef(name)
+		if err != nil && broken != nil {
+			broken(name, err)
+			return nil
+		}
+
+		if err != nil {
+			// Like git, skip symbolic refs that point nowhere and
+			// refs that don't hold an id
+			if err == ErrUnknownRef || err == ErrBadRef {
+				return nil
+			}
+
+			return err
+		}
+
+		// Loose refs take precedence over packed ones
+		refs[name] = ref
+
+		return nil
+	})
+}
+
+// Refs under these prefixes, and those outside of refs/ like HEAD,
+// belong to a single worktree rather than being shared.
+var perWorktreePrefixes = []string{"refs/bisect/", "refs/worktree/", "refs/rewritten/"}
+
+// Return the path of the file the loose ref called name is kept in
+func (r *Repo) refPath(name string) string {
+	switch {
+	case strings.HasPrefix(name, "main-worktree/"):
+		return filepath.Join(r.commonDir(), strings.TrimPrefix(name, "main-worktree/"))
+	case strings.HasPrefix(name, "worktrees/"):
+		return filepath.Join(r.commonDir(), name)
+	case !strings.HasPrefix(name, "refs/"):
+		return filepath.Join(r.Base, name)
+	}
+
+	for _, prefix := range perWorktreePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return filepath.Join(r.Base, name)
+		}
+	}
+
+	return filepath.Join(r.commonDir(), name)
+}
+
+func (r *Repo) readLooseRef(name string) (*Ref, error) {
+	data, err := ioutil.ReadFile(r.refPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	ref := &Ref{Name: name}
+
+	contents := strings.TrimSpace(string(data))
+
+	if strings.HasPrefix(contents, "ref:") {
+		ref.Target = strings.TrimSpace(contents[4:])
+
+		id, ok, err := r.lookupRefDepth(ref.Target, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, ErrUnknownRef
+		}
+
+		ref.Id = id
+	} else {
+		if !r.isObjectId(contents) {
+			return nil, ErrBadRef
+		}
+
+		ref.Id = contents
+	}
+
+	// Loose refs don't record what they peel to, so look for
+	// ourselves.
+	obj, err := r.LoadObject(ref.Id)
+	if err != nil {
+		return ref, nil
+	}
+
+	obj.Close()
+
+	// A tag whose target is missing is still listed, as git does,
+	// just without what it peels to
+	if obj.Type == "tag" {
+		if peeled, err := r.peel(ref.Id); err == nil {
+			ref.Peeled = peeled
+		}
+	}
+
+	return ref, nil
+}
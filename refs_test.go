@@ -0,0 +1,193 @@
+package gitreader
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoReadPackedRefs(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	refs, err := repo.readPackedRefs()
+	require.NoError(t, err)
+
+	expected := []packedRef{
+		{"refs/heads/master", "d98d560efac8fd704bf8ca215c7c103473a98b2e", ""},
+		{"refs/heads/packed", "3e15650095622b50da9e805b2d0550b5961512c9", ""},
+		{"refs/tags/v0.9", "28908be3f744c6ce8598a26cb28087d7e1353014", "3e15650095622b50da9e805b2d0550b5961512c9"},
+	}
+
+	assert.Equal(t, expected, refs)
+}
+
+func TestRepoRefs(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	refs, err := repo.Refs("")
+	require.NoError(t, err)
+
+	commit := "3e15650095622b50da9e805b2d0550b5961512c9"
+
+	expected := []*Ref{
+		{Name: "refs/heads/master", Id: commit},
+		{Name: "refs/heads/packed", Id: commit},
+		{Name: "refs/heads/stale", Id: "d98d560efac8fd704bf8ca215c7c103473a98b2e"},
+		{Name: "refs/remotes/origin/HEAD", Id: commit, Target: "refs/remotes/origin/master"},
+		{Name: "refs/remotes/origin/master", Id: commit},
+		{Name: "refs/tags/light", Id: commit},
+		{Name: "refs/tags/stale", Id: commit},
+		{Name: "refs/tags/v0.9", Id: "28908be3f744c6ce8598a26cb28087d7e1353014", Peeled: commit},
+		{Name: "refs/tags/v1.0", Id: "fdf5d07cb55e17f15299d19d5697ee99b6a31075", Peeled: commit},
+		{Name: "refs/tags/v1.0-alias", Id: "d5cd1af9232ecd38e688d4be330a61dff566817e", Peeled: commit},
+		{Name: "refs/tags/v1.0-signed", Id: "9e9f33f8efe1901659f4c4c666d9c5cf4ed35b69", Peeled: commit},
+		{Name: "refs/tags/v1.0-tree", Id: "5120f8f742a84586b7834160d0381709f5d51c7b", Peeled: "b28f66668670da36a8618360d1f16f3415dfaa3f"},
+	}
+
+	assert.Equal(t, expected, refs)
+}
+
+func TestRepoRefsPrefix(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	refs, err := repo.Refs("refs/heads/")
+	require.NoError(t, err)
+
+	var names []string
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+
+	assert.Equal(t, []string{"refs/heads/master", "refs/heads/packed", "refs/heads/stale"}, names)
+}
+
+func TestBareRepoRefsPackedOnly(t *testing.T) {
+	repo, err := OpenRepo("fixtures/proj.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	refs, err := repo.Refs("refs/tags/")
+	require.NoError(t, err)
+
+	expected := []*Ref{
+		{Name: "refs/tags/before", Id: "6fe9de222caf76a787e0df553264d0d9f3bc4ead"},
+	}
+
+	assert.Equal(t, expected, refs)
+}
+
+func TestRepoRefsSkipsBroken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	copyDir(t, "fixtures/tags.git", dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "refs", "heads"), 0755))
+
+	for name, contents := range map[string]string{"empty": "\n", "garbage": "not an id\n"} {
+		err = ioutil.WriteFile(filepath.Join(dir, "refs", "heads", name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	refs, err := repo.Refs("refs/heads/")
+	require.NoError(t, err)
+
+	var names []string
+
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+
+	assert.Equal(t, []string{"refs/heads/master", "refs/heads/packed", "refs/heads/stale"}, names)
+}
+
+func TestRepoSymrefCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	copyDir(t, "fixtures/tags.git", dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "refs", "heads"), 0755))
+
+	for name, target := range map[string]string{"a": "refs/heads/b", "b": "refs/heads/a"} {
+		err = ioutil.WriteFile(filepath.Join(dir, "refs", "heads", name), []byte("ref: "+target+"\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	_, err = repo.ResolveRef("a")
+	assert.Equal(t, ErrUnknownRef, err)
+
+	refs, err := repo.Refs("refs/heads/")
+	require.NoError(t, err)
+
+	var names []string
+
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+
+	assert.Equal(t, []string{"refs/heads/master", "refs/heads/packed", "refs/heads/stale"}, names)
+}
+
+func TestRepoRefsTagMissingTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	copyDir(t, "fixtures/tags.git", dir)
+
+	// A tag of an object that has since been deleted
+	body := []byte("object 1111111111111111111111111111111111111111\ntype commit\ntag broken\n\nmsg\n")
+	sum := sha1.Sum([]byte(fmt.Sprintf("tag %d\x00%s", len(body), body)))
+	tagId := hex.EncodeToString(sum[:])
+
+	writeLooseObject(t, dir, tagId, "tag", body)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "refs", "tags"), 0755))
+
+	err = ioutil.WriteFile(filepath.Join(dir, "refs", "tags", "broken"), []byte(tagId+"\n"), 0644)
+	require.NoError(t, err)
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	refs, err := repo.Refs("refs/tags/")
+	require.NoError(t, err)
+
+	require.NotEmpty(t, refs)
+	assert.Equal(t, &Ref{Name: "refs/tags/broken", Id: tagId}, refs[0])
+}
@@ -0,0 +1,447 @@
+package gitreader
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"sort"
+)
+
+// How DetectRenames pairs up files
+type RenameOptions struct {
+	// Also look for copies of files that were modified, like
+	// git diff -C
+	Copies bool
+
+	// How similar two files must be, as a percentage, to be paired.
+	// 0 means git's default of 50.
+	Threshold int
+
+	// Files are only compared for similarity when the number of
+	// sources times the number of destinations is at most the square
+	// of this. 0 means git's default of 1000, and a negative limit
+	// compares everything. Identical files are paired whatever the
+	// limit.
+	Limit int
+}
+
+// Git scores similarity out of this
+const maxRenameScore = 60000
+
+// How many of the best sources are kept for each destination
+const renameCandidates = 4
+
+// Git treats a file as binary if its first 8000 bytes hold a NUL
+const binaryCheckSize = 8000
+
+// A possible pairing of a source and destination of DetectRenames
+type renameMatch struct {
+	src, dst  int
+	score     int
+	nameScore int
+}
+
+// Find the files in changes, as returned by DiffTrees, that were
+// renamed or copied, like git diff -M. Each added file that came from
+// elsewhere is replaced by a change of kind ChangeRenamed or
+// ChangeCopied, and a deleted file that was renamed is dropped. When
+// a deleted file went to more than one place, the last is the rename
+// and the rest are copies. A nil opts uses git's defaults.
+func (r *Repo) DetectRenames(changes []*Change, opts *RenameOptions) ([]*Change, error) {
+	if opts == nil {
+		opts = &RenameOptions{}
+	}
+
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = 50
+	}
+
+	minScore := threshold * maxRenameScore / 100
+
+	limit := opts.Limit
+	if limit == 0 {
+		limit = 1000
+	}
+
+	var srcs, dsts []*Change
+
+	for _, change := range changes {
+		switch change.Kind {
+		case ChangeAdded:
+			dsts = append(dsts, change)
+		case ChangeDeleted:
+			srcs = append(srcs, change)
+		case ChangeModified, ChangeTypeChanged:
+			if opts.Copies {
+				srcs = append(srcs, change)
+			}
+		}
+	}
+
+	if len(srcs) == 0 || len(dsts) == 0 {
+		return changes, nil
+	}
+
+	srcIndex := make(map[*Change]int)
+	for i, src := range srcs {
+		srcIndex[src] = i
+	}
+
+	used := make([]int, len(srcs))
+	matched := make(map[*Change]*renameMatch)
+
+	record := func(m *renameMatch) {
+		used[m.src]++
+		matched[dsts[m.dst]] = m
+	}
+
+	// Identical files first, preferring sources that haven't been
+	// used and have the same name
+	byId := make(map[string][]int)
+	for i, src := range srcs {
+		byId[src.OldId] = append(byId[src.OldId], i)
+	}
+
+	for d, dst := range dsts {
+		best := &renameMatch{src: -1, score: maxRenameScore, nameScore: -1}
+
+		for _, s := range byId[dst.NewId] {
+			src := srcs[s]
+
+			// Anything but a file can only match the same kind of thing
+			if (!isRegularMode(src.OldMode) || !isRegularMode(dst.NewMode)) && src.OldMode != dst.NewMode {
+				continue
+			}
+
+			if used[s] > 0 && !opts.Copies {
+				continue
+			}
+
+			score := 0
+			if used[s] == 0 {
+				score++
+			}
+
+			score += renameNameScore(src, dst)
+
+			if score > best.nameScore {
+				best.src, best.dst, best.nameScore = s, d, score
+			}
+		}
+
+		if best.src != -1 {
+			record(best)
+		}
+	}
+
+	// Then files that are similar enough
+	var srcLeft, dstLeft []int
+
+	for s := range srcs {
+		if used[s] == 0 || opts.Copies {
+			srcLeft = append(srcLeft, s)
+		}
+	}
+
+	for d, dst := range dsts {
+		if matched[dst] == nil {
+			dstLeft = append(dstLeft, d)
+		}
+	}
+
+	if len(srcLeft) > 0 && len(dstLeft) > 0 && tooManyRenames(len(srcLeft), len(dstLeft), limit) {
+		srcLeft = nil
+	}
+
+	var candidates []*renameMatch
+
+	spans := make(map[string]*blobSpans)
+
+	load := func(id string) (*blobSpans, error) {
+		if s, ok := spans[id]; ok {
+			return s, nil
+		}
+
+		s, err := r.loadBlobSpans(id)
+		if err != nil {
+			return nil, err
+		}
+
+		spans[id] = s
+		return s, nil
+	}
+
+	for _, d := range dstLeft {
+		dst := dsts[d]
+		if !isRegularMode(dst.NewMode) {
+			continue
+		}
+
+		var best []*renameMatch
+
+		for _, s := range srcLeft {
+			src := srcs[s]
+			if !isRegularMode(src.OldMode) {
+				continue
+			}
+
+			srcSpans, err := load(src.OldId)
+			if err != nil {
+				return nil, err
+			}
+
+			dstSpans, err := load(dst.NewId)
+			if err != nil {
+				return nil, err
+			}
+
+			m := &renameMatch{
+				src:       s,
+				dst:       d,
+				score:     similarity(srcSpans, dstSpans, minScore),
+				nameScore: renameNameScore(src, dst),
+			}
+
+			if m.score < minScore {
+				continue
+			}
+
+			best = append(best, m)
+			sortRenameMatches(best)
+
+			if len(best) > renameCandidates {
+				best = best[:renameCandidates]
+			}
+		}
+
+		candidates = append(candidates, best...)
+	}
+
+	sortRenameMatches(candidates)
+
+	for _, m := range candidates {
+		if matched[dsts[m.dst]] == nil && used[m.src] == 0 {
+			record(m)
+		}
+	}
+
+	if opts.Copies {
+		for _, m := range candidates {
+			if matched[dsts[m.dst]] == nil {
+				record(m)
+			}
+		}
+	}
+
+	// A deleted file that went elsewhere is gone, and its last use
+	// is its rename
+	last := make(map[int]*Change)
+	for _, change := range changes {
+		if m := matched[change]; m != nil {
+			last[m.src] = change
+		}
+	}
+
+	var out []*Change
+
+	for _, change := range changes {
+		m := matched[change]
+		if m == nil {
+			if change.Kind != ChangeDeleted || used[srcIndex[change]] == 0 {
+				out = append(out, change)
+			}
+
+			continue
+		}
+
+		src := srcs[m.src]
+
+		kind := ChangeCopied
+		if src.Kind == ChangeDeleted && last[m.src] == change {
+			kind = ChangeRenamed
+		}
+
+		out = append(out, &Change{
+			Kind:    kind,
+			Path:    change.Path,
+			OldPath: src.Path,
+			Score:   m.score * 100 / maxRenameScore,
+			OldMode: src.OldMode,
+			NewMode: change.NewMode,
+			OldId:   src.OldId,
+			NewId:   change.NewId,
+		})
+	}
+
+	return out, nil
+}
+
+func isRegularMode(mode string) bool {
+	return modeType(mode) == 0100000
+}
+
+// Give a pairing a point for keeping the file's name, as git does
+func renameNameScore(src, dst *Change) int {
+	if path.Base(src.Path) == path.Base(dst.Path) {
+		return 1
+	}
+
+	return 0
+}
+
+// Best score first, then those keeping the name. Otherwise the order
+// is kept.
+func sortRenameMatches(matches []*renameMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		if a.score != b.score {
+			return a.score > b.score
+		}
+
+		return a.nameScore > b.nameScore
+	})
+}
+
+// Report whether comparing every source with every destination would
+// be too much work, like git's diff.renameLimit
+func tooManyRenames(srcs, dsts, limit int) bool {
+	if limit < 0 {
+		return false
+	}
+
+	if srcs > limit && dsts > limit {
+		return true
+	}
+
+	return uint64(srcs)*uint64(dsts) > uint64(limit)*uint64(limit)
+}
+
+// A summary of a blob's content for measuring similarity. The blob
+// is cut into lines, or 64 byte pieces of long lines, and the number
+// of bytes in the pieces with each hash is counted.
+type blobSpans struct {
+	size   uint64
+	counts map[uint32]uint64
+}
+
+const spanHashBase = 107927
+
+// Read the blob id and summarize it the way git's diffcore-delta does
+func (r *Repo) loadBlobSpans(id string) (*blobSpans, error) {
+	obj, err := r.LoadObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer obj.Close()
+
+	if obj.Type != "blob" {
+		return nil, ErrNotBlob
+	}
+
+	blob, err := obj.Blob()
+	if err != nil {
+		return nil, err
+	}
+
+	spans := &blobSpans{size: obj.Size, counts: make(map[uint32]uint64)}
+
+	in := bufio.NewReaderSize(blob, binaryCheckSize)
+
+	head, err := in.Peek(binaryCheckSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// A CR before a LF is ignored in text
+	text := !isBinary(head)
+
+	var (
+		accum1, accum2 uint32
+		n              uint64
+	)
+
+	for {
+		c, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if text && c == '\r' {
+			if next, err := in.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+
+		old1 := accum1
+		accum1 = accum1<<7 ^ accum2>>25
+		accum2 = accum2<<7 ^ old1>>25
+		accum1 += uint32(c)
+
+		n++
+		if n < 64 && c != '\n' {
+			continue
+		}
+
+		spans.counts[(accum1+accum2*0x61)%spanHashBase] += n
+
+		n, accum1, accum2 = 0, 0, 0
+	}
+
+	if n > 0 {
+		spans.counts[(accum1+accum2*0x61)%spanHashBase] += n
+	}
+
+	return spans, nil
+}
+
+// Score how much of dst was copied from src, out of maxRenameScore.
+// Files whose sizes differ too much to reach minScore aren't compared.
+func similarity(src, dst *blobSpans, minScore int) int {
+	maxSize, minSize := src.size, dst.size
+	if maxSize < minSize {
+		maxSize, minSize = minSize, maxSize
+	}
+
+	if maxSize*uint64(maxRenameScore-minScore) < (maxSize-minSize)*maxRenameScore {
+		return 0
+	}
+
+	if dst.size == 0 {
+		return 0
+	}
+
+	var copied uint64
+
+	for hash, srcCount := range src.counts {
+		dstCount := dst.counts[hash]
+
+		if srcCount < dstCount {
+			copied += srcCount
+		} else {
+			copied += dstCount
+		}
+	}
+
+	return int(copied * maxRenameScore / maxSize)
+}
+
+func isBinary(data []byte) bool {
+	if len(data) > binaryCheckSize {
+		data = data[:binaryCheckSize]
+	}
+
+	for _, c := range data {
+		if c == 0 {
+			return true
+		}
+	}
+
+	return false
+}
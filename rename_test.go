@@ -0,0 +1,111 @@
+package gitreader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRenames(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	tests := []struct {
+		old, new string
+		opts     *RenameOptions
+		raw      string
+	}{
+		{"004e64b^", "004e64b", nil, `:100644 100644 418bfd7198a213be12b0258ef3461dcdf3db5544 caeff445e452771e965c39f8dfc02e862862566f R092	src/util.go	src/helpers.go`},
+		{"004e64b^", "004e64b", &RenameOptions{Threshold: 90}, `:100644 100644 418bfd7198a213be12b0258ef3461dcdf3db5544 caeff445e452771e965c39f8dfc02e862862566f R092	src/util.go	src/helpers.go`},
+		{"004e64b^", "004e64b", &RenameOptions{Threshold: 95}, `:000000 100644 0000000000000000000000000000000000000000 caeff445e452771e965c39f8dfc02e862862566f A	src/helpers.go
+:100644 000000 418bfd7198a213be12b0258ef3461dcdf3db5544 0000000000000000000000000000000000000000 D	src/util.go`},
+		{"v0.1", "main", nil, `:100644 120000 f4705862b3d061ff755fa5c54ef1e73dc52f630d eafc2aac7162cad4e1f335fab78ae18b297e49cc T	README
+:000000 100644 0000000000000000000000000000000000000000 78981922613b2afb6025042ff6bd878ac1994e85 A	a.txt
+:000000 100644 0000000000000000000000000000000000000000 61780798228d17af2d34fce4cfbdf35556832472 A	b.txt
+:100644 100644 c540cb81a2e3a291c2955e235d2131366a65d935 b97fafb2d1384275d23c362e112032793d2810da M	docs/guide.md
+:000000 120000 0000000000000000000000000000000000000000 656dfc3f55927e2e845c06c3d626d03d4adf8d88 A	docs/latest
+:000000 100644 0000000000000000000000000000000000000000 a80ba770ef1bde4b48403b666eaa3fc41113a070 A	logo.png
+:100644 000000 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 0000000000000000000000000000000000000000 D	old/one.txt
+:100644 000000 23d7551c8807066404defd73664d74f13c37f342 0000000000000000000000000000000000000000 D	old/two.txt
+:100644 100755 1d46b4fb938096013aab00ba630d124b8bcd3b9d 1d46b4fb938096013aab00ba630d124b8bcd3b9d M	scripts/build.sh
+:100644 100644 418bfd7198a213be12b0258ef3461dcdf3db5544 caeff445e452771e965c39f8dfc02e862862566f R092	src/util.go	src/helpers.go
+:000000 100644 0000000000000000000000000000000000000000 caeff445e452771e965c39f8dfc02e862862566f A	src/helpers_copy.go
+:100644 100644 d8fa929218fa6365064ddcfc4eb40ad3f8ed91c0 7ce968d3a141624ddfdc7dbb0c9eefc749d424b3 M	src/main.go
+:000000 100644 0000000000000000000000000000000000000000 625990ecaf194482317256e4e7690402ec1dd3e4 A	src/parser.go`},
+		{"v0.1", "main", &RenameOptions{Copies: true}, `:100644 120000 f4705862b3d061ff755fa5c54ef1e73dc52f630d eafc2aac7162cad4e1f335fab78ae18b297e49cc T	README
+:000000 100644 0000000000000000000000000000000000000000 78981922613b2afb6025042ff6bd878ac1994e85 A	a.txt
+:000000 100644 0000000000000000000000000000000000000000 61780798228d17af2d34fce4cfbdf35556832472 A	b.txt
+:100644 100644 c540cb81a2e3a291c2955e235d2131366a65d935 b97fafb2d1384275d23c362e112032793d2810da M	docs/guide.md
+:000000 120000 0000000000000000000000000000000000000000 656dfc3f55927e2e845c06c3d626d03d4adf8d88 A	docs/latest
+:000000 100644 0000000000000000000000000000000000000000 a80ba770ef1bde4b48403b666eaa3fc41113a070 A	logo.png
+:100644 000000 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 0000000000000000000000000000000000000000 D	old/one.txt
+:100644 000000 23d7551c8807066404defd73664d74f13c37f342 0000000000000000000000000000000000000000 D	old/two.txt
+:100644 100755 1d46b4fb938096013aab00ba630d124b8bcd3b9d 1d46b4fb938096013aab00ba630d124b8bcd3b9d M	scripts/build.sh
+:100644 100644 418bfd7198a213be12b0258ef3461dcdf3db5544 caeff445e452771e965c39f8dfc02e862862566f C092	src/util.go	src/helpers.go
+:100644 100644 418bfd7198a213be12b0258ef3461dcdf3db5544 caeff445e452771e965c39f8dfc02e862862566f R092	src/util.go	src/helpers_copy.go
+:100644 100644 d8fa929218fa6365064ddcfc4eb40ad3f8ed91c0 7ce968d3a141624ddfdc7dbb0c9eefc749d424b3 M	src/main.go
+:000000 100644 0000000000000000000000000000000000000000 625990ecaf194482317256e4e7690402ec1dd3e4 A	src/parser.go`},
+	}
+
+	for _, test := range tests {
+		changes, err := repo.DiffTrees(test.old, test.new)
+		require.NoError(t, err)
+
+		changes, err = repo.DetectRenames(changes, test.opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, test.raw, rawChanges(changes), test.old+" "+test.new)
+	}
+
+	// Three deleted files and seven added ones are too many to compare
+	// with a limit of 3, like git diff -M -l3
+	changes, err := repo.DiffTrees("v0.1", "main")
+	require.NoError(t, err)
+
+	changes, err = repo.DetectRenames(changes, &RenameOptions{Limit: 3})
+	require.NoError(t, err)
+
+	for _, change := range changes {
+		assert.NotEqual(t, ChangeRenamed, change.Kind, change.String())
+	}
+
+	changes, err = repo.DiffTrees("v0.1", "main")
+	require.NoError(t, err)
+
+	changes, err = repo.DetectRenames(changes, &RenameOptions{Limit: 7})
+	require.NoError(t, err)
+
+	assert.Equal(t, ChangeRenamed, changes[9].Kind)
+}
+
+func TestDetectExactRenames(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	one := "aaa876fbb1d019146f54fd9a5081a0b44a6752f3"
+
+	changes := []*Change{
+		{Kind: ChangeAdded, Path: "a/one.txt", NewMode: "100644", NewId: one},
+		{Kind: ChangeAdded, Path: "b/uno.txt", NewMode: "100644", NewId: one},
+		{Kind: ChangeAdded, Path: "link", NewMode: "120000", NewId: one},
+		{Kind: ChangeDeleted, Path: "old/one.txt", OldMode: "100644", OldId: one},
+	}
+
+	// Without copies the file is renamed once, to the place that
+	// keeps its name
+	found, err := repo.DetectRenames(changes, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, `:100644 100644 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 R100	old/one.txt	a/one.txt
+:000000 100644 0000000000000000000000000000000000000000 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 A	b/uno.txt
+:000000 120000 0000000000000000000000000000000000000000 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 A	link`, rawChanges(found))
+
+	// With them it is also copied, and the last use is the rename
+	found, err = repo.DetectRenames(changes, &RenameOptions{Copies: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, `:100644 100644 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 C100	old/one.txt	a/one.txt
+:100644 100644 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 R100	old/one.txt	b/uno.txt
+:000000 120000 0000000000000000000000000000000000000000 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 A	link`, rawChanges(found))
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -16,65 +17,228 @@ type Loader interface {
 type Repo struct {
 	Base    string
 	Loaders []Loader
+
+	// Where objects and shared refs are kept. For a linked worktree
+	// this is the repo the worktree was added to; otherwise it's
+	// the same as Base.
+	CommonDir string
+
+	// The top of the working tree, if it is known. Empty for bare
+	// repos.
+	WorkTree string
+
+	// The repo's config file, along with any files it includes
+	Config *Config
+
+	// The hash used to name objects, from extensions.objectFormat
+	Format *ObjectFormat
+
+	// The parents, tree and date of commits, used by history walks
+	// so that they don't need to read every commit. Nil if the repo
+	// doesn't have a commit-graph.
+	CommitGraph *CommitGraph
+
+	// If set, LoadObject hashes each object as its body is read. When
+	// the content doesn't match the id, reading the end of the body
+	// returns a *CorruptObjectError.
+	VerifyObjects bool
 }
 
 var ErrInvalidRepo = errors.New("invalid repo")
 
-// Open up a repository. Can be either normal or bare.
+// Open up a repository. Can be either normal or bare. A .git
+// file containing a "gitdir:" line, as used by submodules and
+// linked worktrees, is followed to the real repository.
 // Be sure to issue Close() on a repo when you're finished
 // with it because that makes sure that any pack files
 // used by the repo are properly unmapped.
 func OpenRepo(path string) (*Repo, error) {
-	tries := []string{filepath.Join(path, ".git"), path}
+	repo, err := openGitDir(filepath.Join(path, ".git"))
+	if err == nil {
+		repo.WorkTree, err = filepath.Abs(path)
+		if err != nil {
+			repo.Close()
+			return nil, err
+		}
 
-	var repoPath string
+		return repo, nil
+	}
 
-	for _, dir := range tries {
-		testDir := filepath.Join(dir, "objects")
+	if err != ErrInvalidRepo {
+		return nil, err
+	}
 
-		if _, err := os.Stat(testDir); err != nil {
-			continue
-		}
+	return openGitDir(path)
+}
 
-		repoPath = dir
-		break
+// Open the repository whose git directory is dir, following dir if
+// it's a gitdir file. Returns ErrInvalidRepo if there isn't one.
+func openGitDir(dir string) (*Repo, error) {
+	gitDir, err := readGitFile(dir)
+	if err != nil {
+		return nil, ErrInvalidRepo
 	}
 
-	if repoPath == "" {
+	common := findCommonDir(gitDir)
+
+	if _, err := os.Stat(filepath.Join(common, "objects")); err != nil {
 		return nil, ErrInvalidRepo
 	}
 
-	repo := &Repo{repoPath, nil}
+	repo := &Repo{Base: gitDir, CommonDir: common}
+
+	repo.Config, err = repo.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.Format = SHA1
+
+	if name, err := repo.Config.Get("extensions.objectFormat"); err == nil {
+		repo.Format, err = LookupObjectFormat(name)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	err := repo.initLoaders()
+	err = repo.initLoaders()
 	if err != nil {
 		return nil, err
 	}
 
+	repo.loadCommitGraph()
+
 	return repo, nil
 }
 
+// If path is a file with a "gitdir:" line, return the directory
+// it points to. Otherwise path is expected to be the directory.
+func readGitFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		return path, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	line := strings.TrimSpace(string(data))
+
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", ErrInvalidRepo
+	}
+
+	dir := strings.TrimSpace(line[7:])
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+
+	return dir, nil
+}
+
+// Linked worktrees name the repo they share objects and refs with
+// in a commondir file. Every other repo is its own common dir.
+func findCommonDir(gitDir string) string {
+	data, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+
+	dir := strings.TrimSpace(string(data))
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitDir, dir)
+	}
+
+	return filepath.Clean(dir)
+}
+
+func (r *Repo) format() *ObjectFormat {
+	if r.Format != nil {
+		return r.Format
+	}
+
+	return SHA1
+}
+
+func (r *Repo) commonDir() string {
+	if r.CommonDir != "" {
+		return r.CommonDir
+	}
+
+	return r.Base
+}
+
 func (r *Repo) Close() error {
-	for _, loader := range r.Loaders {
-		loader.Close()
+	closeLoaders(r.Loaders)
+
+	if r.CommitGraph != nil {
+		r.CommitGraph.Close()
 	}
 
 	return nil
 }
 
 func (r *Repo) initLoaders() error {
-	loaders := []Loader{&LooseObject{r.Base}}
+	seen := make(map[string]bool)
 
-	packs := filepath.Join(r.Base, "objects/pack")
+	loaders, err := loadObjectsDir(filepath.Join(r.commonDir(), "objects"), r.format(), seen, 0)
+	if err != nil {
+		return err
+	}
+
+	r.Loaders = loaders
+
+	return nil
+}
+
+// Build the Loaders for the objects directory dir, followed by
+// those of any alternate object stores it lists. Objects are named
+// using format.
+func loadObjectsDir(dir string, format *ObjectFormat, seen map[string]bool, depth int) ([]Loader, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen[abs] = true
+
+	loaders := []Loader{&LooseObject{Objects: dir, Format: format}}
+
+	packs := filepath.Join(dir, "pack")
+
+	// Packs covered by a multi-pack-index are read through it. If it
+	// is missing, unreadable or for another hash, we fall back to
+	// reading each pack on its own, as git does.
+	covered := make(map[string]bool)
+
+	midx, err := LoadMultiPackIndex(packs)
+	if err == nil && midx.format != format {
+		midx.Close()
+	} else if err == nil {
+		loaders = append(loaders, midx)
+
+		for _, name := range midx.PackNames {
+			covered[name] = true
+		}
+	}
 
 	files, err := ioutil.ReadDir(packs)
 	if err == nil {
 		for _, file := range files {
 			n := file.Name()
-			if filepath.Ext(n) == ".idx" {
-				pack, err := LoadPack(filepath.Join(packs, n[:len(n)-4]))
+			if filepath.Ext(n) == ".idx" && !covered[n] {
+				pack, err := LoadPackFormat(filepath.Join(packs, n[:len(n)-4]), format)
 				if err != nil {
-					return err
+					closeLoaders(loaders)
+					return nil, err
 				}
 
 				loaders = append(loaders, pack)
@@ -82,50 +246,79 @@ func (r *Repo) initLoaders() error {
 		}
 	}
 
-	r.Loaders = loaders
+	alternates, err := loadAlternates(dir, format, seen, depth)
+	if err != nil {
+		closeLoaders(loaders)
+		return nil, err
+	}
 
-	return nil
+	return append(loaders, alternates...), nil
 }
 
-var refDirs = []string{"heads", "tags"}
+// Close loaders, such as those opened before an error
+func closeLoaders(loaders []Loader) {
+	for _, loader := range loaders {
+		loader.Close()
+	}
+}
 
 var ErrUnknownRef = errors.New("unknown ref")
 
-// Given a reference, return the object id for the commit
+// Returned for a ref whose contents aren't an object id or a
+// symbolic ref, as left behind by a crash mid-write
+var ErrBadRef = errors.New("ref does not contain an object id")
+
+var ErrBadTag = errors.New("tag does not name an object")
+
+// Given a revision, return the object id for the commit it names.
+// Any revision understood by RevParse can be used, such as "HEAD~3"
+// or "v1.2^{tree}". Annotated tags are peeled until a non-tag object
+// is reached.
 func (r *Repo) ResolveRef(ref string) (string, error) {
-	if ref == "HEAD" {
-		return r.resolveIndirect(filepath.Join(r.Base, "HEAD"))
+	id, err := r.RevParse(ref)
+	if err != nil {
+		return "", err
 	}
 
-	for _, dir := range refDirs {
-		path := filepath.Join(r.Base, "refs", dir, ref)
+	return r.peel(id)
+}
 
-		data, err := ioutil.ReadFile(path)
+// Follow a chain of tag objects starting at id and return the
+// id of the object at the end of it
+func (r *Repo) peel(id string) (string, error) {
+	for {
+		obj, err := r.LoadObject(id)
 		if err != nil {
-			continue
+			return "", err
 		}
 
-		return strings.TrimSpace(string(data)), nil
-	}
+		if obj.Type != "tag" {
+			obj.Close()
+			return id, nil
+		}
 
-	path := filepath.Join(r.Base, ref)
-	data, err := ioutil.ReadFile(path)
-	if err == nil {
-		return strings.TrimSpace(string(data)), nil
-	}
+		tag, err := obj.Tag()
+		obj.Close()
 
-	// this might be a raw ref. See if there is a commit there and if so
-	// accept it as is.
+		if err != nil {
+			return "", err
+		}
 
-	obj, err := r.LoadObject(ref)
-	if err == nil && obj.Type == "commit" {
-		return ref, nil
-	}
+		if !r.isObjectId(tag.Object) {
+			return "", ErrBadTag
+		}
 
-	return "", ErrUnknownRef
+		id = tag.Object
+	}
 }
 
-func (r *Repo) resolveIndirect(path string) (string, error) {
+// Git gives up on a chain of symbolic refs this long, which is most
+// likely a cycle
+const maxSymrefDepth = 5
+
+// Read the ref file at path, following it if it's a symbolic ref.
+// depth is how many symbolic refs were followed to get here.
+func (r *Repo) resolveIndirect(path string, depth int) (string, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return "", err
@@ -133,8 +326,25 @@ func (r *Repo) resolveIndirect(path string) (string, error) {
 
 	id := strings.TrimSpace(string(data))
 
-	if id[0:4] == "ref:" {
-		return r.ResolveRef(strings.TrimSpace(id[4:]))
+	if strings.HasPrefix(id, "ref:") {
+		if depth >= maxSymrefDepth {
+			return "", ErrUnknownRef
+		}
+
+		id, ok, err := r.lookupRefDepth(strings.TrimSpace(id[4:]), depth+1)
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			return "", ErrUnknownRef
+		}
+
+		return id, nil
+	}
+
+	if !r.isObjectId(id) {
+		return "", ErrBadRef
 	}
 
 	return id, nil
@@ -152,12 +362,67 @@ func (r *Repo) LoadObject(id string) (*Object, error) {
 			return nil, err
 		}
 
+		if r.VerifyObjects {
+			verifyObject(obj, strings.ToLower(id), loader, r.format())
+		}
+
 		return obj, nil
 	}
 
 	return nil, ErrNotExist
 }
 
+// Implemented by Loaders that can search for abbreviated ids
+type PrefixFinder interface {
+	FindPrefix(prefix string) ([]string, error)
+}
+
+var ErrBadPrefix = errors.New("invalid object id prefix")
+
+// Given an abbreviated object id, return the full id of the one
+// object that it matches. If more than one object matches, an
+// *AmbiguousRevisionError listing every candidate is returned.
+func (r *Repo) ResolvePrefix(prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+
+	if len(prefix) < 2 || len(prefix) > r.format().HexSize() || !isHex(prefix) {
+		return "", ErrBadPrefix
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+
+	for _, loader := range r.Loaders {
+		finder, ok := loader.(PrefixFinder)
+		if !ok {
+			continue
+		}
+
+		found, err := finder.FindPrefix(prefix)
+		if err != nil {
+			return "", err
+		}
+
+		for _, id := range found {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", ErrNotExist
+	case 1:
+		return ids[0], nil
+	}
+
+	sort.Strings(ids)
+
+	return "", &AmbiguousRevisionError{prefix, ids}
+}
+
 var ErrNotCommit = errors.New("ref is not a commit")
 var ErrNotTree = errors.New("object is not a tree")
 var ErrNotBlob = errors.New("object is not a blob")
@@ -183,51 +448,7 @@ func (r *Repo) Resolve(ref, path string) (string, error) {
 		return "", err
 	}
 
-	treeObj, err := r.LoadObject(commit.Tree)
-	if err != nil {
-		return "", err
-	}
-
-	if treeObj.Type != "tree" {
-		return "", ErrNotTree
-	}
-
-	tree, err := treeObj.Tree()
-	if err != nil {
-		return "", err
-	}
-
-	segments := strings.Split(path, "/")
-
-	for _, seg := range segments[:len(segments)-1] {
-		nextId, ok := tree.Entries[seg]
-		if !ok {
-			return "", ErrNotExist
-		}
-
-		obj, err := r.LoadObject(nextId.Id)
-		if err != nil {
-			return "", err
-		}
-
-		if obj.Type != "tree" {
-			return "", ErrNotTree
-		}
-
-		tree, err = obj.Tree()
-		if err != nil {
-			return "", err
-		}
-	}
-
-	final := segments[len(segments)-1]
-
-	nextId, ok := tree.Entries[final]
-	if !ok {
-		return "", ErrNotExist
-	}
-
-	return nextId.Id, nil
+	return r.lookupPath(commit.Tree, path)
 }
 
 // Given a ref and a path to a blob, return the blob data
@@ -1,7 +1,12 @@
 package gitreader
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +35,11 @@ func TestRepoResolveRefHEAD(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, "bdae0e92f4a7ca0ec05b6c2decab9dc18361750b", id)
+
+	top, err := filepath.Abs("fixtures/proj")
+	require.NoError(t, err)
+
+	assert.Equal(t, top, repo.WorkTree)
 }
 
 func TestRepoResolveRefBranch(t *testing.T) {
@@ -74,8 +84,10 @@ func TestBareRepoResolveRefHEAD(t *testing.T) {
 
 	defer repo.Close()
 
-	_, err = repo.ResolveRef("HEAD")
-	require.Error(t, err)
+	id, err := repo.ResolveRef("HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bdae0e92f4a7ca0ec05b6c2decab9dc18361750b", id)
 }
 
 func TestBareRepoResolveRefBranch(t *testing.T) {
@@ -84,8 +96,10 @@ func TestBareRepoResolveRefBranch(t *testing.T) {
 
 	defer repo.Close()
 
-	_, err = repo.ResolveRef("master")
-	require.Error(t, err)
+	id, err := repo.ResolveRef("master")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bdae0e92f4a7ca0ec05b6c2decab9dc18361750b", id)
 }
 
 func TestBareRepoResolveRefTag(t *testing.T) {
@@ -94,8 +108,10 @@ func TestBareRepoResolveRefTag(t *testing.T) {
 
 	defer repo.Close()
 
-	_, err = repo.ResolveRef("before")
-	require.Error(t, err)
+	id, err := repo.ResolveRef("before")
+	require.NoError(t, err)
+
+	assert.Equal(t, "6fe9de222caf76a787e0df553264d0d9f3bc4ead", id)
 }
 
 func TestRepoLoadObject(t *testing.T) {
@@ -156,3 +172,175 @@ func TestRepoCatFile(t *testing.T) {
 
 	assert.Equal(t, "web: puma\nworker: sidekiq\n", string(all))
 }
+
+func TestRepoResolveRefAnnotatedTag(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	id, err := repo.ResolveRef("v1.0")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+}
+
+func TestRepoResolveRefTagChain(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	id, err := repo.ResolveRef("v1.0-alias")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+
+	id, err = repo.ResolveRef("d5cd1af9232ecd38e688d4be330a61dff566817e")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+}
+
+func TestRepoCatFileThroughTag(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	blob, err := repo.CatFile("v1.0-signed", "Procfile")
+	require.NoError(t, err)
+
+	all, err := blob.Bytes()
+	require.NoError(t, err)
+
+	assert.Equal(t, "web: puma\n", string(all))
+}
+
+func TestRepoResolveRefPackedBranch(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	id, err := repo.ResolveRef("packed")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+
+	id, err = repo.ResolveRef("refs/heads/packed")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+}
+
+func TestRepoResolveRefPackedTag(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	id, err := repo.ResolveRef("v0.9")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+}
+
+func TestRepoResolveRefLooseOverPacked(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	id, err := repo.ResolveRef("master")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+}
+
+func TestRepoResolvePrefix(t *testing.T) {
+	repo, err := OpenRepo("fixtures/proj")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	// loose
+	id, err := repo.ResolvePrefix("bdae0e9")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bdae0e92f4a7ca0ec05b6c2decab9dc18361750b", id)
+
+	// packed
+	id, err = repo.ResolvePrefix("6FE9DE2")
+	require.NoError(t, err)
+
+	assert.Equal(t, "6fe9de222caf76a787e0df553264d0d9f3bc4ead", id)
+
+	// both loose and packed
+	id, err = repo.ResolvePrefix("467")
+	require.NoError(t, err)
+
+	assert.Equal(t, "467c21715563cbf5bf52ae79616e02914b89e9f1", id)
+
+	_, err = repo.ResolvePrefix("ffff")
+	assert.Equal(t, ErrNotExist, err)
+
+	_, err = repo.ResolvePrefix("xyz")
+	assert.Equal(t, ErrBadPrefix, err)
+}
+
+func TestRepoResolvePrefixAmbiguous(t *testing.T) {
+	repo, err := OpenRepo("fixtures/proj")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	_, err = repo.ResolvePrefix("5e")
+	require.Error(t, err)
+
+	amb, ok := err.(*AmbiguousRevisionError)
+	require.True(t, ok)
+
+	expected := []string{
+		"5e261634a4f66a3f85836713b1c0a9df93d685d4",
+		"5e7f457bb1732f4315f3b6193ee85efdf7735d50",
+	}
+
+	assert.Equal(t, expected, amb.Candidates)
+}
+
+func TestRepoResolveRefBroken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	copyDir(t, "fixtures/tags.git", dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "refs", "heads"), 0755))
+
+	// A ref left empty by a crash mid-write
+	err = ioutil.WriteFile(filepath.Join(dir, "refs", "heads", "empty"), []byte("\n"), 0644)
+	require.NoError(t, err)
+
+	// A tag with no object header
+	body := []byte("type commit\ntag x\n\nmsg\n")
+	sum := sha1.Sum([]byte(fmt.Sprintf("tag %d\x00%s", len(body), body)))
+	tagId := hex.EncodeToString(sum[:])
+
+	writeLooseObject(t, dir, tagId, "tag", body)
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	_, err = repo.ResolveRef("empty")
+	assert.Equal(t, ErrBadRef, err)
+
+	_, err = repo.ResolveRef(tagId)
+	assert.Equal(t, ErrBadTag, err)
+
+	_, err = repo.LoadObject("")
+	assert.Equal(t, ErrNotExist, err)
+}
@@ -0,0 +1,641 @@
+package gitreader
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned when a revision is malformed or names something that
+// can't be followed, such as the second parent of a commit that
+// only has one.
+type InvalidRevisionError struct {
+	Rev, Reason string
+}
+
+func (e *InvalidRevisionError) Error() string {
+	return fmt.Sprintf("invalid revision %q: %s", e.Rev, e.Reason)
+}
+
+// Returned when a revision could name more than one object.
+// Candidates holds everything it could have meant.
+type AmbiguousRevisionError struct {
+	Rev        string
+	Candidates []string
+}
+
+func (e *AmbiguousRevisionError) Error() string {
+	return fmt.Sprintf("ambiguous revision %q: could be %s", e.Rev, strings.Join(e.Candidates, ", "))
+}
+
+var ErrNotTag = errors.New("object is not a tag")
+
+// The order git tries to expand a short ref name in
+var refRules = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// Return the object id named by rev, in the same way as git rev-parse.
+// Supported syntax includes:
+//
+//	HEAD, @, master, v1.2, refs/heads/master   ref names
+//	<40 hex digits>, <4 or more hex digits>    object ids and abbreviations
+//	rev^, rev^2, rev~3                         parents and ancestors
+//	rev^{commit}, rev^{tree}, rev^{}           peeling to a type
+//	rev^{/fix}                                 newest reachable commit matching a regex
+//	rev:path/to/file                           an entry in rev's tree
+//	:/fix                                      newest commit from any ref matching a regex
+//
+// Unlike ResolveRef, annotated tags are not peeled unless asked for,
+// so "v1.2" returns the id of the tag object itself.
+func (r *Repo) RevParse(rev string) (string, error) {
+	if strings.HasPrefix(rev, ":/") {
+		starts, err := r.allRefTips()
+		if err != nil {
+			return "", err
+		}
+
+		return r.searchMessage(rev, starts, rev[2:])
+	}
+
+	if strings.HasPrefix(rev, ":") {
+		return "", &InvalidRevisionError{rev, "the index is not supported"}
+	}
+
+	if i := pathSeparator(rev); i != -1 {
+		id, err := r.revParseObject(rev[:i])
+		if err != nil {
+			return "", err
+		}
+
+		tree, err := r.peelTo(id, "tree")
+		if err != nil {
+			return "", err
+		}
+
+		return r.lookupPath(tree, rev[i+1:])
+	}
+
+	return r.revParseObject(rev)
+}
+
+// Find the ':' separating a tree-ish from a path, ignoring any
+// inside ^{...}
+func pathSeparator(rev string) int {
+	depth := 0
+
+	for i := 0; i < len(rev); i++ {
+		switch {
+		case rev[i] == '{':
+			depth++
+		case rev[i] == '}' && depth > 0:
+			depth--
+		case rev[i] == ':' && depth == 0:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Parse rev, which may end in a chain of ^ and ~ suffixes, working
+// backward from the last suffix.
+func (r *Repo) revParseObject(rev string) (string, error) {
+	if rev == "" {
+		return "", &InvalidRevisionError{rev, "empty revision"}
+	}
+
+	if strings.HasSuffix(rev, "}") {
+		if open := strings.LastIndex(rev, "^{"); open > 0 {
+			id, err := r.revParseObject(rev[:open])
+			if err != nil {
+				return "", err
+			}
+
+			return r.peelRevision(rev, id, rev[open+2:len(rev)-1])
+		}
+	}
+
+	end := len(rev)
+	for end > 0 && rev[end-1] >= '0' && rev[end-1] <= '9' {
+		end--
+	}
+
+	if end > 0 && (rev[end-1] == '^' || rev[end-1] == '~') {
+		n := 1
+
+		if end < len(rev) {
+			var err error
+			n, err = strconv.Atoi(rev[end:])
+			if err != nil {
+				return "", &InvalidRevisionError{rev, err.Error()}
+			}
+		}
+
+		if end == 1 {
+			return "", &InvalidRevisionError{rev, "missing revision before " + rev[:1]}
+		}
+
+		id, err := r.revParseObject(rev[:end-1])
+		if err != nil {
+			return "", err
+		}
+
+		if rev[end-1] == '^' {
+			return r.nthParent(rev, id, n)
+		}
+
+		return r.nthAncestor(rev, id, n)
+	}
+
+	return r.revParseName(rev)
+}
+
+// Handle the contents of a ^{...} suffix
+func (r *Repo) peelRevision(rev, id, arg string) (string, error) {
+	switch {
+	case arg == "":
+		return r.peel(id)
+	case arg == "commit", arg == "tree", arg == "blob", arg == "tag", arg == "object":
+		return r.peelTo(id, arg)
+	case strings.HasPrefix(arg, "/"):
+		commit, err := r.peelTo(id, "commit")
+		if err != nil {
+			return "", err
+		}
+
+		return r.searchMessage(rev, []string{commit}, arg[1:])
+	}
+
+	return "", &InvalidRevisionError{rev, "unknown object type " + arg}
+}
+
+// Resolve a revision with no suffixes: an object id or a ref name
+func (r *Repo) revParseName(name string) (string, error) {
+	if name == "@" {
+		name = "HEAD"
+	}
+
+	if strings.Contains(name, "@{") {
+		return "", &InvalidRevisionError{name, "reflog syntax is not supported"}
+	}
+
+	if r.isObjectId(name) {
+		if _, err := r.LoadObject(name); err == nil {
+			return name, nil
+		}
+	}
+
+	_, ids, err := r.expandRef(name, false)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ids) == 0 {
+		// Refs win over abbreviated ids, as they do in git
+		if len(name) >= minAbbrev && isHex(name) {
+			id, err := r.ResolvePrefix(name)
+			if err == ErrNotExist {
+				return "", ErrUnknownRef
+			}
+
+			return id, err
+		}
+
+		return "", ErrUnknownRef
+	}
+
+	return ids[0], nil
+}
+
+// Return the full names of the refs that the short ref name could
+// mean, in the order git tries them. Revisions resolve to the first
+// of them; git warns that the name is ambiguous when there's more
+// than one.
+func (r *Repo) ExpandRef(name string) ([]string, error) {
+	names, _, err := r.expandRef(name, true)
+	return names, err
+}
+
+// Expand name with each of refRules, returning the full names and ids
+// of the refs found. Stops at the first one unless all is set.
+func (r *Repo) expandRef(name string, all bool) ([]string, []string, error) {
+	var names, ids []string
+
+	for _, rule := range refRules {
+		// Only names that look like refs may be read straight out of
+		// the repo directory, otherwise "config" would be a ref.
+		if rule == "%s" && !isFullRefName(name) {
+			continue
+		}
+
+		full := fmt.Sprintf(rule, name)
+
+		id, ok, err := r.lookupRef(full)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if ok {
+			names = append(names, full)
+			ids = append(ids, id)
+
+			if !all {
+				break
+			}
+		}
+	}
+
+	return names, ids, nil
+}
+
+// Report whether name can be looked up without expanding it
+func isFullRefName(name string) bool {
+	// Refs of other worktrees are named like main-worktree/HEAD
+	// and worktrees/<id>/HEAD
+	if i := strings.IndexByte(name, '/'); i != -1 {
+		switch name[:i] {
+		case "refs", "main-worktree", "worktrees":
+			return true
+		}
+
+		return false
+	}
+
+	return isPseudoRef(name)
+}
+
+// Names like HEAD and ORIG_HEAD that live at the top of the repo
+func isPseudoRef(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		if (c < 'A' || c > 'Z') && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Repo) isObjectId(s string) bool {
+	return len(s) == r.format().HexSize() && isHex(s)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Like git, don't treat anything shorter than this as an
+// abbreviated id
+const minAbbrev = 4
+
+// Return the n'th parent of the commit named by id. The 0th parent
+// is the commit itself.
+func (r *Repo) nthParent(rev, id string, n int) (string, error) {
+	id, err := r.peelTo(id, "commit")
+	if err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		return id, nil
+	}
+
+	commit, err := r.loadCommit(id)
+	if err != nil {
+		return "", err
+	}
+
+	if n > len(commit.Parents) {
+		return "", &InvalidRevisionError{rev, fmt.Sprintf("%s has no parent %d", id, n)}
+	}
+
+	return commit.Parents[n-1], nil
+}
+
+// Follow the first parent of the commit named by id n times
+func (r *Repo) nthAncestor(rev, id string, n int) (string, error) {
+	id, err := r.peelTo(id, "commit")
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; i < n; i++ {
+		id, err = r.nthParent(rev, id, 1)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// Dereference id until an object of type typ is found. Tags are
+// followed to their targets and commits to their trees. The type
+// "object" accepts any object at all.
+func (r *Repo) peelTo(id, typ string) (string, error) {
+	for {
+		obj, err := r.LoadObject(id)
+		if err != nil {
+			return "", err
+		}
+
+		if obj.Type == typ || typ == "object" {
+			obj.Close()
+			return id, nil
+		}
+
+		switch {
+		case obj.Type == "tag":
+			tag, err := obj.Tag()
+			obj.Close()
+			if err != nil {
+				return "", err
+			}
+
+			id = tag.Object
+		case obj.Type == "commit" && typ == "tree":
+			commit, err := obj.Commit()
+			obj.Close()
+			if err != nil {
+				return "", err
+			}
+
+			id = commit.Tree
+		default:
+			obj.Close()
+
+			switch typ {
+			case "commit":
+				return "", ErrNotCommit
+			case "tree":
+				return "", ErrNotTree
+			case "blob":
+				return "", ErrNotBlob
+			default:
+				return "", ErrNotTag
+			}
+		}
+	}
+}
+
+func (r *Repo) loadCommit(id string) (*Commit, error) {
+	obj, err := r.LoadObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer obj.Close()
+
+	if obj.Type != "commit" {
+		return nil, ErrNotCommit
+	}
+
+	return obj.Commit()
+}
+
+func (r *Repo) loadTree(id string) (*Tree, error) {
+	obj, err := r.LoadObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer obj.Close()
+
+	if obj.Type != "tree" {
+		return nil, ErrNotTree
+	}
+
+	return obj.Tree()
+}
+
+// Return the id of the entry at path beneath the tree treeId.
+// An empty path returns the tree itself.
+func (r *Repo) lookupPath(treeId, path string) (string, error) {
+	id := treeId
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return id, nil
+	}
+
+	for _, seg := range strings.Split(path, "/") {
+		tree, err := r.loadTree(id)
+		if err != nil {
+			return "", err
+		}
+
+		entry, ok := tree.Entries[seg]
+		if !ok {
+			return "", ErrNotExist
+		}
+
+		id = entry.Id
+	}
+
+	return id, nil
+}
+
+// Return the entry at path beneath the tree treeId, or nil if there
+// isn't one. An empty treeId stands for the empty tree, and an empty
+// path for the tree itself.
+func (r *Repo) lookupEntry(treeId, path string) (*Entry, error) {
+	if treeId == "" {
+		return nil, nil
+	}
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return &Entry{Permissions: "40000", Id: treeId}, nil
+	}
+
+	dir, name := "", path
+	if i := strings.LastIndexByte(path, '/'); i != -1 {
+		dir, name = path[:i], path[i+1:]
+	}
+
+	dirId, err := r.lookupPath(treeId, dir)
+	if err == nil {
+		var tree *Tree
+		tree, err = r.loadTree(dirId)
+		if err == nil {
+			return tree.Entries[name], nil
+		}
+	}
+
+	if err == ErrNotExist || err == ErrNotTree {
+		return nil, nil
+	}
+
+	return nil, err
+}
+
+// The commits that HEAD and every ref point to, for :/ searches
+func (r *Repo) allRefTips() ([]string, error) {
+	var tips []string
+
+	if id, ok, err := r.lookupRef("HEAD"); err == nil && ok {
+		tips = append(tips, id)
+	}
+
+	refs, err := r.Refs("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range refs {
+		id, err := r.peelTo(ref.Id, "commit")
+		if err != nil {
+			continue
+		}
+
+		tips = append(tips, id)
+	}
+
+	return tips, nil
+}
+
+// Find the newest commit reachable from starts whose message
+// matches pattern. A pattern beginning with "!-" matches commits
+// that don't match the rest of it, and "!!" matches a literal "!".
+func (r *Repo) searchMessage(rev string, starts []string, pattern string) (string, error) {
+	negate := false
+
+	if strings.HasPrefix(pattern, "!") {
+		switch {
+		case strings.HasPrefix(pattern, "!-"):
+			negate = true
+			pattern = pattern[2:]
+		case strings.HasPrefix(pattern, "!!"):
+			pattern = pattern[1:]
+		default:
+			return "", &InvalidRevisionError{rev, "unknown modifier in " + pattern}
+		}
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", &InvalidRevisionError{rev, err.Error()}
+	}
+
+	queue := &commitQueue{}
+	seen := make(map[string]bool)
+
+	push := func(id string) error {
+		if seen[id] {
+			return nil
+		}
+
+		seen[id] = true
+
+		commit, err := r.loadCommit(id)
+		if err != nil {
+			return err
+		}
+
+		heap.Push(queue, newQueuedCommit(id, commit))
+		return nil
+	}
+
+	for _, id := range starts {
+		if err := push(id); err != nil {
+			return "", err
+		}
+	}
+
+	for queue.Len() > 0 {
+		next := heap.Pop(queue).(*queuedCommit)
+
+		if re.MatchString(next.commit.Message) != negate {
+			return next.id, nil
+		}
+
+		for _, parent := range next.commit.Parents {
+			if err := push(parent); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return "", &InvalidRevisionError{rev, "no commit message matches " + pattern}
+}
+
+// What a history walk needs to know about a commit
+type queuedCommit struct {
+	id      string
+	tree    string
+	parents []string
+	when    time.Time
+
+	// From the commit-graph, or 0 if it isn't known
+	generation uint64
+
+	// The commit itself, if it was read to find the above
+	commit *Commit
+
+	// The order the commit was pushed in, to break ties
+	seq uint64
+}
+
+func newQueuedCommit(id string, commit *Commit) *queuedCommit {
+	return &queuedCommit{
+		id:      id,
+		tree:    commit.Tree,
+		parents: commit.Parents,
+		when:    commit.Committer.When,
+		commit:  commit,
+	}
+}
+
+// A heap of commits with the newest committer date on top. Commits
+// with the same date come out in the order they were pushed.
+type commitQueue struct {
+	items  []*queuedCommit
+	pushed uint64
+}
+
+func (q *commitQueue) Len() int { return len(q.items) }
+
+func (q *commitQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+
+	if !a.when.Equal(b.when) {
+		return a.when.After(b.when)
+	}
+
+	return a.seq < b.seq
+}
+
+func (q *commitQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *commitQueue) Push(x interface{}) {
+	item := x.(*queuedCommit)
+	item.seq = q.pushed
+	q.pushed++
+
+	q.items = append(q.items, item)
+}
+
+func (q *commitQueue) Pop() interface{} {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
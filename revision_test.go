@@ -0,0 +1,117 @@
+package gitreader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevParse(t *testing.T) {
+	repo, err := OpenRepo("fixtures/history.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	tests := map[string]string{
+		"HEAD":             "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8",
+		"@":                "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8",
+		"main":             "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8",
+		"refs/heads/main":  "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8",
+		"HEAD~3":           "004e64b9cd0591af35345b0e27a2dfb7356aece1",
+		"HEAD^^^":          "004e64b9cd0591af35345b0e27a2dfb7356aece1",
+		"HEAD~4^2":         "58093088d2e26942d54605d42502d23d24e3fa21",
+		"HEAD~4^3":         "631e210f6c96c52bc169da6cde79eeccf2b25133",
+		"HEAD~4^2~1":       "f8ed0f8d65e62019f40b9e74ffb830016bb98088",
+		"v1.0":             "5dab2034c9310193b4d1973538e9e50c96e9b607",
+		"tags/v1.0":        "5dab2034c9310193b4d1973538e9e50c96e9b607",
+		"v1.0^{}":          "f8ed0f8d65e62019f40b9e74ffb830016bb98088",
+		"v1.0^0":           "f8ed0f8d65e62019f40b9e74ffb830016bb98088",
+		"v1.0^{commit}":    "f8ed0f8d65e62019f40b9e74ffb830016bb98088",
+		"v1.0^{tree}":      "596ec54a1ec379163f91ddd1691748f51f4957fa",
+		"v1.0^{tag}":       "5dab2034c9310193b4d1973538e9e50c96e9b607",
+		"HEAD:src/main.go": "7ce968d3a141624ddfdc7dbb0c9eefc749d424b3",
+		"main~2:docs":      "4e3e2f60cb7183a76fef59238280338ae716982d",
+		"HEAD^{/docs}":     "c9a5789da1613be93d0eaba9a2cb7fb6c3b59f06",
+		":/feature: add":   "ea1410f0a4d4d8bfd5e7e091d482c9612eb316e9",
+		":/!-Merge":        "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8",
+
+		"f8ed0f8d65e62019f40b9e74ffb830016bb98088~1": "c9a5789da1613be93d0eaba9a2cb7fb6c3b59f06",
+		"f8ed0f8~1":  "c9a5789da1613be93d0eaba9a2cb7fb6c3b59f06",
+		"5dab203^{}": "f8ed0f8d65e62019f40b9e74ffb830016bb98088",
+	}
+
+	for rev, expected := range tests {
+		id, err := repo.RevParse(rev)
+		require.NoError(t, err, rev)
+
+		assert.Equal(t, expected, id, rev)
+	}
+}
+
+func TestRevParseInvalid(t *testing.T) {
+	repo, err := OpenRepo("fixtures/history.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	for _, rev := range []string{"HEAD^4", "v0.1~1", "HEAD^{frob}", "~1", "HEAD@{1}", ":/^no such message$"} {
+		_, err := repo.RevParse(rev)
+		require.Error(t, err, rev)
+
+		_, ok := err.(*InvalidRevisionError)
+		assert.True(t, ok, "%s: %s", rev, err)
+	}
+
+	_, err = repo.RevParse("nosuchbranch")
+	assert.Equal(t, ErrUnknownRef, err)
+
+	_, err = repo.RevParse("HEAD:no/such/file")
+	assert.Equal(t, ErrNotExist, err)
+
+	_, err = repo.RevParse("HEAD:src/main.go^{tree}")
+	assert.Equal(t, ErrNotExist, err)
+
+	_, err = repo.RevParse("HEAD^{tree}^{commit}")
+	assert.Equal(t, ErrNotCommit, err)
+}
+
+func TestRevParseAmbiguousRef(t *testing.T) {
+	repo, err := OpenRepo("fixtures/tags.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	// Like git, the tag wins over the branch
+	id, err := repo.RevParse("stale")
+	require.NoError(t, err)
+
+	assert.Equal(t, "3e15650095622b50da9e805b2d0550b5961512c9", id)
+
+	names, err := repo.ExpandRef("stale")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"refs/tags/stale", "refs/heads/stale"}, names)
+
+	names, err = repo.ExpandRef("master")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"refs/heads/master"}, names)
+}
+
+func TestRepoResolveRefRevision(t *testing.T) {
+	repo, err := OpenRepo("fixtures/history.git")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	id, err := repo.ResolveRef("v1.0~1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "c9a5789da1613be93d0eaba9a2cb7fb6c3b59f06", id)
+
+	id, err = repo.ResolveRef("v1.0")
+	require.NoError(t, err)
+
+	assert.Equal(t, "f8ed0f8d65e62019f40b9e74ffb830016bb98088", id)
+}
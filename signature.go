@@ -0,0 +1,95 @@
+package gitreader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The identity and timestamp recorded in the author, committer
+// and tagger lines of commits and tags
+type Signature struct {
+	Name, Email string
+
+	// The timestamp, in the timezone offset it was recorded with
+	When time.Time
+}
+
+// Parse an identity line such as
+// "Evan Phoenix <evan@phx.io> 1418539320 -0800".
+//
+// Parsing is lenient, in the same way as git's, because old
+// repositories contain plenty of malformed identities. Missing
+// pieces are left empty and a bad timezone is treated as UTC.
+func ParseSignature(line string) Signature {
+	var sig Signature
+
+	lt := strings.IndexByte(line, '<')
+	if lt == -1 {
+		sig.Name = strings.TrimSpace(line)
+		return sig
+	}
+
+	sig.Name = strings.TrimSpace(line[:lt])
+
+	gt := strings.IndexByte(line[lt:], '>')
+	if gt == -1 {
+		sig.Email = strings.TrimSpace(line[lt+1:])
+		return sig
+	}
+
+	sig.Email = strings.TrimSpace(line[lt+1 : lt+gt])
+
+	// Like git, take the date from after the last '>' so that
+	// stray brackets in the identity don't confuse us.
+	rest := strings.Fields(line[strings.LastIndexByte(line, '>')+1:])
+	if len(rest) == 0 {
+		return sig
+	}
+
+	secs, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil {
+		return sig
+	}
+
+	loc := time.UTC
+
+	if len(rest) > 1 {
+		if offset, ok := parseTimezone(rest[1]); ok {
+			loc = time.FixedZone("", offset)
+		}
+	}
+
+	sig.When = time.Unix(secs, 0).In(loc)
+
+	return sig
+}
+
+// Parse a git timezone such as "-0800" into an offset in seconds
+func parseTimezone(tz string) (int, bool) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return 0, false
+	}
+
+	hhmm, err := strconv.Atoi(tz[1:])
+	if err != nil {
+		return 0, false
+	}
+
+	offset := (hhmm/100)*3600 + (hhmm%100)*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	return offset, true
+}
+
+// Format the signature the way it is written in an object
+func (s Signature) String() string {
+	if s.When.IsZero() {
+		return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+	}
+
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
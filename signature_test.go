@@ -0,0 +1,59 @@
+package gitreader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignature(t *testing.T) {
+	sig := ParseSignature("Evan Phoenix <evan@phx.io> 1418539320 -0800")
+
+	assert.Equal(t, "Evan Phoenix", sig.Name)
+	assert.Equal(t, "evan@phx.io", sig.Email)
+	assert.Equal(t, int64(1418539320), sig.When.Unix())
+
+	_, offset := sig.When.Zone()
+	assert.Equal(t, -8*3600, offset)
+	assert.Equal(t, 22, sig.When.Hour())
+
+	assert.Equal(t, "Evan Phoenix <evan@phx.io> 1418539320 -0800", sig.String())
+}
+
+func TestParseSignaturePositiveOffset(t *testing.T) {
+	sig := ParseSignature("A U Thor <author@example.com> 1112911993 +0530")
+
+	_, offset := sig.When.Zone()
+	assert.Equal(t, 5*3600+30*60, offset)
+	assert.Equal(t, "A U Thor <author@example.com> 1112911993 +0530", sig.String())
+}
+
+func TestParseSignatureMalformed(t *testing.T) {
+	sig := ParseSignature("Evan Phoenix <evan@phx.io>")
+	assert.Equal(t, "Evan Phoenix", sig.Name)
+	assert.Equal(t, "evan@phx.io", sig.Email)
+	assert.True(t, sig.When.IsZero())
+
+	sig = ParseSignature("<evan@phx.io> 1418539320 -0800")
+	assert.Equal(t, "", sig.Name)
+	assert.Equal(t, "evan@phx.io", sig.Email)
+	assert.Equal(t, int64(1418539320), sig.When.Unix())
+
+	sig = ParseSignature("Evan Phoenix 1418539320 -0800")
+	assert.Equal(t, "Evan Phoenix 1418539320 -0800", sig.Name)
+	assert.Equal(t, "", sig.Email)
+
+	sig = ParseSignature("Evan Phoenix <evan@phx.io> 1418539320 bogus")
+	assert.Equal(t, int64(1418539320), sig.When.Unix())
+	assert.Equal(t, time.UTC, sig.When.Location())
+
+	sig = ParseSignature("Evan <Phoenix> <evan@phx.io> 1418539320 -0800")
+	assert.Equal(t, "Evan", sig.Name)
+	assert.Equal(t, "Phoenix", sig.Email)
+	assert.Equal(t, int64(1418539320), sig.When.Unix())
+
+	sig = ParseSignature("Evan Phoenix <evan@phx.io> garbage")
+	assert.Equal(t, "evan@phx.io", sig.Email)
+	assert.True(t, sig.When.IsZero())
+}
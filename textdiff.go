@@ -0,0 +1,587 @@
+package gitreader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// How DiffBlobs, DiffFile and DiffChange compare files
+type TextDiffOptions struct {
+	Algorithm DiffAlgorithm
+
+	// The number of unchanged lines shown around each change
+	Context int
+}
+
+// Git's defaults: Myers with 3 lines of context
+var defaultTextDiffOptions = TextDiffOptions{Algorithm: DiffMyers, Context: 3}
+
+// How a line of a hunk is shown in a patch
+type DiffOp byte
+
+const (
+	DiffContext DiffOp = ' '
+	DiffDelete  DiffOp = '-'
+	DiffInsert  DiffOp = '+'
+)
+
+type DiffLine struct {
+	Op DiffOp
+
+	// The line without its newline
+	Text string
+
+	// Set on the last line of a file that doesn't end in a newline
+	NoNewline bool
+}
+
+// A run of changes along with the lines around them
+type Hunk struct {
+	// The first line of each side the hunk covers, counting from 1,
+	// and how many lines it covers. A side with no lines starts at
+	// the line before, as in the hunk header.
+	OldStart, OldLines int
+	NewStart, NewLines int
+
+	// The nearest line above the hunk that looks like the start of a
+	// function, which git shows after the line numbers
+	Section string
+
+	Lines []*DiffLine
+}
+
+// The differences between two versions of a file. The path, mode and
+// id of a side the file doesn't exist on are empty.
+type FileDiff struct {
+	OldPath, NewPath string
+	OldMode, NewMode string
+	OldId, NewId     string
+
+	// What happened to the file, and for renames and copies how
+	// similar the two versions are as a percentage
+	Kind  ChangeKind
+	Score int
+
+	// Set if either version is binary. The lines of a binary version
+	// aren't diffed.
+	Binary bool
+
+	// A file that changed type, such as a file becoming a symlink, is
+	// shown the way git shows it, as the old version being deleted and
+	// the new one created. Its hunks delete every old line and then
+	// add every new one.
+	Hunks []*Hunk
+
+	oldBinary, newBinary bool
+}
+
+// The number of hex digits ids are shortened to on the index line
+const patchAbbrev = 7
+
+// Git only uses this much of a function line in a hunk header
+const sectionSize = 80
+
+// Diff the contents of the blobs oldId and newId. Either may be empty
+// for a file that doesn't exist. A nil opts uses the defaults. Text
+// blobs are read fully into memory to be compared, while only the
+// first 8000 bytes of a binary one are read.
+func (r *Repo) DiffBlobs(oldId, newId string, opts *TextDiffOptions) (*FileDiff, error) {
+	diff := &FileDiff{
+		OldPath: oldId,
+		NewPath: newId,
+		OldId:   oldId,
+		NewId:   newId,
+		Kind:    ChangeModified,
+	}
+
+	// Git shows blobs compared on their own as regular files
+	if oldId != "" {
+		diff.OldMode = "100644"
+	}
+
+	if newId != "" {
+		diff.NewMode = "100644"
+	}
+
+	return diff, r.diffContents(diff, opts)
+}
+
+// Diff the file at path as of the revisions oldRev and newRev, which
+// may name commits or trees. Returns ErrNotExist if neither has it.
+// The blobs are read as DiffBlobs reads them.
+func (r *Repo) DiffFile(oldRev, newRev, path string, opts *TextDiffOptions) (*FileDiff, error) {
+	var entries [2]*Entry
+
+	for i, rev := range []string{oldRev, newRev} {
+		tree, err := r.resolveTree(rev)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := r.lookupEntry(tree, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry != nil && isTreeMode(entry.Permissions) {
+			return nil, ErrNotBlob
+		}
+
+		entries[i] = entry
+	}
+
+	old, new := entries[0], entries[1]
+
+	diff := &FileDiff{Kind: ChangeModified}
+
+	switch {
+	case old == nil && new == nil:
+		return nil, ErrNotExist
+	case old == nil:
+		diff.Kind = ChangeAdded
+	case new == nil:
+		diff.Kind = ChangeDeleted
+	case modeType(old.Permissions) != modeType(new.Permissions):
+		diff.Kind = ChangeTypeChanged
+	}
+
+	path = strings.Trim(path, "/")
+
+	if old != nil {
+		diff.OldPath, diff.OldMode, diff.OldId = path, old.Permissions, old.Id
+	}
+
+	if new != nil {
+		diff.NewPath, diff.NewMode, diff.NewId = path, new.Permissions, new.Id
+	}
+
+	return diff, r.diffContents(diff, opts)
+}
+
+// Diff the file a change from DiffTrees or DetectRenames is about.
+// The blobs are read as DiffBlobs reads them.
+func (r *Repo) DiffChange(change *Change, opts *TextDiffOptions) (*FileDiff, error) {
+	diff := &FileDiff{
+		Kind:    change.Kind,
+		Score:   change.Score,
+		OldMode: change.OldMode,
+		NewMode: change.NewMode,
+		OldId:   change.OldId,
+		NewId:   change.NewId,
+	}
+
+	if change.OldId != "" {
+		diff.OldPath = change.Path
+		if change.OldPath != "" {
+			diff.OldPath = change.OldPath
+		}
+	}
+
+	if change.NewId != "" {
+		diff.NewPath = change.Path
+	}
+
+	return diff, r.diffContents(diff, opts)
+}
+
+// Read both sides of diff and fill in its hunks
+func (r *Repo) diffContents(diff *FileDiff, opts *TextDiffOptions) error {
+	if opts == nil {
+		opts = &defaultTextDiffOptions
+	}
+
+	if diff.OldId == diff.NewId {
+		return nil
+	}
+
+	oldLines, oldBinary, err := r.readLines(diff.OldId, diff.OldMode)
+	if err != nil {
+		return err
+	}
+
+	newLines, newBinary, err := r.readLines(diff.NewId, diff.NewMode)
+	if err != nil {
+		return err
+	}
+
+	diff.Binary = oldBinary || newBinary
+	diff.oldBinary, diff.newBinary = oldBinary, newBinary
+
+	if diff.typeChanged() {
+		if !oldBinary {
+			diff.Hunks = DiffLines(oldLines, nil, opts)
+		}
+
+		if !newBinary {
+			diff.Hunks = append(diff.Hunks, DiffLines(nil, newLines, opts)...)
+		}
+
+		return nil
+	}
+
+	if !diff.Binary {
+		diff.Hunks = DiffLines(oldLines, newLines, opts)
+	}
+
+	return nil
+}
+
+func (d *FileDiff) typeChanged() bool {
+	return d.OldId != "" && d.NewId != "" && modeType(d.OldMode) != modeType(d.NewMode)
+}
+
+// Read the whole of the blob id as lines, each ending in its newline
+// except perhaps the last. Only the first binaryCheckSize bytes are
+// read if it turns out to be binary. A submodule is shown as the
+// commit it's at.
+func (r *Repo) readLines(id, mode string) ([]string, bool, error) {
+	if id == "" {
+		return nil, false, nil
+	}
+
+	if modeType(mode) == 0160000 {
+		return []string{"Subproject commit " + id + "\n"}, false, nil
+	}
+
+	obj, err := r.LoadObject(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer obj.Close()
+
+	if obj.Type != "blob" {
+		return nil, false, ErrNotBlob
+	}
+
+	blob, err := obj.Blob()
+	if err != nil {
+		return nil, false, err
+	}
+
+	in := bufio.NewReaderSize(blob, binaryCheckSize)
+
+	head, err := in.Peek(binaryCheckSize)
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+
+	if isBinary(head) {
+		return nil, true, nil
+	}
+
+	var lines []string
+
+	for {
+		line, err := in.ReadString('\n')
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+
+		if err == io.EOF {
+			return lines, false, nil
+		}
+
+		if err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// Diff two files given as lines, each ending in its newline except
+// perhaps the last, and return the hunks a patch would show. Changes
+// are placed where git diff --no-indent-heuristic places them. A nil
+// opts uses the defaults.
+func DiffLines(oldLines, newLines []string, opts *TextDiffOptions) []*Hunk {
+	if opts == nil {
+		opts = &defaultTextDiffOptions
+	}
+
+	d := newLineDiffer(oldLines, newLines, opts.Algorithm)
+	d.run()
+
+	// Pair up the lines, with deletions before insertions
+	type edit struct {
+		op       DiffOp
+		old, new int
+	}
+
+	var edits []edit
+
+	for i, j := 0, 0; i < len(oldLines) || j < len(newLines); {
+		switch {
+		case i < len(oldLines) && d.aChanged[i]:
+			edits = append(edits, edit{DiffDelete, i, j})
+			i++
+		case j < len(newLines) && d.bChanged[j]:
+			edits = append(edits, edit{DiffInsert, i, j})
+			j++
+		default:
+			edits = append(edits, edit{DiffContext, i, j})
+			i++
+			j++
+		}
+	}
+
+	context := opts.Context
+	if context < 0 {
+		context = 0
+	}
+
+	var hunks []*Hunk
+
+	for start := 0; start < len(edits); {
+		if edits[start].op == DiffContext {
+			start++
+			continue
+		}
+
+		// Take in later changes while no more than two contexts' worth
+		// of unchanged lines separate them
+		end := start
+		for {
+			for end < len(edits) && edits[end].op != DiffContext {
+				end++
+			}
+
+			gap := end
+			for gap < len(edits) && edits[gap].op == DiffContext {
+				gap++
+			}
+
+			if gap == len(edits) || gap-end > 2*context {
+				break
+			}
+
+			end = gap
+		}
+
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+
+		last := end + context
+		if last > len(edits) {
+			last = len(edits)
+		}
+
+		hunk := &Hunk{
+			OldStart: edits[first].old,
+			NewStart: edits[first].new,
+		}
+
+		for _, e := range edits[first:last] {
+			var line string
+
+			switch e.op {
+			case DiffDelete:
+				line = oldLines[e.old]
+				hunk.OldLines++
+			case DiffInsert:
+				line = newLines[e.new]
+				hunk.NewLines++
+			default:
+				line = oldLines[e.old]
+				hunk.OldLines++
+				hunk.NewLines++
+			}
+
+			hunk.Lines = append(hunk.Lines, &DiffLine{
+				Op:        e.op,
+				Text:      strings.TrimSuffix(line, "\n"),
+				NoNewline: !strings.HasSuffix(line, "\n"),
+			})
+		}
+
+		hunk.Section = findSection(oldLines, hunk.OldStart)
+
+		if hunk.OldLines > 0 {
+			hunk.OldStart++
+		}
+
+		if hunk.NewLines > 0 {
+			hunk.NewStart++
+		}
+
+		hunks = append(hunks, hunk)
+
+		start = last
+	}
+
+	return hunks
+}
+
+// Find the last line before the line numbered before, counting from
+// 0, that git's default rule takes as the start of a function: one
+// starting with a letter, _ or $
+func findSection(lines []string, before int) string {
+	for i := before - 1; i >= 0; i-- {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+
+		c := line[0]
+		if c == '_' || c == '$' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+			if len(line) > sectionSize {
+				line = line[:sectionSize]
+			}
+
+			return strings.TrimRight(line, " \t\r\n\v\f")
+		}
+	}
+
+	return ""
+}
+
+// Format the header line of the hunk, like "@@ -1,3 +1,4 @@"
+func (h *Hunk) Header() string {
+	header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+
+	if h.Section != "" {
+		header += " " + h.Section
+	}
+
+	return header
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Write the diff the way git diff formats it. Returns the first error
+// from writing to w.
+func (d *FileDiff) WritePatch(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	if d.typeChanged() {
+		deleted := &FileDiff{
+			OldPath: d.OldPath,
+			OldMode: d.OldMode,
+			OldId:   d.OldId,
+			Kind:    ChangeDeleted,
+			Binary:  d.oldBinary,
+		}
+
+		created := &FileDiff{
+			NewPath: d.NewPath,
+			NewMode: d.NewMode,
+			NewId:   d.NewId,
+			Kind:    ChangeAdded,
+			Binary:  d.newBinary,
+		}
+
+		for _, hunk := range d.Hunks {
+			if hunk.NewLines == 0 {
+				deleted.Hunks = append(deleted.Hunks, hunk)
+			} else {
+				created.Hunks = append(created.Hunks, hunk)
+			}
+		}
+
+		deleted.writePatch(out)
+		created.writePatch(out)
+	} else {
+		d.writePatch(out)
+	}
+
+	// A bufio.Writer keeps the first error it hits
+	return out.Flush()
+}
+
+func (d *FileDiff) writePatch(out *bufio.Writer) {
+	oldName, newName := "a/"+d.OldPath, "b/"+d.NewPath
+	if d.OldPath == "" {
+		oldName = "a/" + d.NewPath
+	}
+
+	if d.NewPath == "" {
+		newName = "b/" + d.OldPath
+	}
+
+	fmt.Fprintf(out, "diff --git %s %s\n", oldName, newName)
+
+	switch {
+	case d.OldId == "":
+		fmt.Fprintf(out, "new file mode %s\n", rawMode(d.NewMode))
+	case d.NewId == "":
+		fmt.Fprintf(out, "deleted file mode %s\n", rawMode(d.OldMode))
+	case d.OldMode != d.NewMode:
+		fmt.Fprintf(out, "old mode %s\nnew mode %s\n", rawMode(d.OldMode), rawMode(d.NewMode))
+	}
+
+	switch d.Kind {
+	case ChangeRenamed:
+		fmt.Fprintf(out, "similarity index %d%%\nrename from %s\nrename to %s\n", d.Score, d.OldPath, d.NewPath)
+	case ChangeCopied:
+		fmt.Fprintf(out, "similarity index %d%%\ncopy from %s\ncopy to %s\n", d.Score, d.OldPath, d.NewPath)
+	}
+
+	if d.OldId != d.NewId {
+		fmt.Fprintf(out, "index %s..%s", abbrevId(d.OldId), abbrevId(d.NewId))
+
+		if d.OldMode == d.NewMode && d.OldMode != "" {
+			fmt.Fprintf(out, " %s", rawMode(d.OldMode))
+		}
+
+		out.WriteString("\n")
+	}
+
+	oldLabel, newLabel := oldName, newName
+	if d.OldId == "" {
+		oldLabel = "/dev/null"
+	}
+
+	if d.NewId == "" {
+		newLabel = "/dev/null"
+	}
+
+	if d.Binary {
+		fmt.Fprintf(out, "Binary files %s and %s differ\n", oldLabel, newLabel)
+	} else if len(d.Hunks) > 0 {
+		fmt.Fprintf(out, "--- %s\n+++ %s\n", oldLabel, newLabel)
+
+		for _, hunk := range d.Hunks {
+			out.WriteString(hunk.Header())
+			out.WriteString("\n")
+
+			for _, line := range hunk.Lines {
+				out.WriteByte(byte(line.Op))
+				out.WriteString(line.Text)
+				out.WriteString("\n")
+
+				if line.NoNewline {
+					out.WriteString("\\ No newline at end of file\n")
+				}
+			}
+		}
+	}
+}
+
+// Return the diff formatted the way git diff does
+func (d *FileDiff) Patch() string {
+	var out bytes.Buffer
+	d.WritePatch(&out)
+	return out.String()
+}
+
+// Shorten id for an index line. A missing id is shown as zeros.
+func abbrevId(id string) string {
+	if id == "" {
+		return strings.Repeat("0", patchAbbrev)
+	}
+
+	if len(id) > patchAbbrev {
+		return id[:patchAbbrev]
+	}
+
+	return id
+}
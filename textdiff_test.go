@@ -0,0 +1,401 @@
+package gitreader
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTextDiff(t *testing.T) *Repo {
+	repo, err := OpenRepo("fixtures/textdiff.git")
+	require.NoError(t, err)
+
+	return repo
+}
+
+func TestDiffFile(t *testing.T) {
+	repo := openTextDiff(t)
+	defer repo.Close()
+
+	tests := []struct {
+		path  string
+		opts  *TextDiffOptions
+		patch string
+	}{
+		{"prog.c", nil, `diff --git a/prog.c b/prog.c
+index 6faa5a3..e3af329 100644
+--- a/prog.c
++++ b/prog.c
+@@ -1,26 +1,25 @@
+ #include <stdio.h>
+ 
+-// Frobs foo heartily
+-int frobnitz(int foo)
++int fib(int n)
+ {
+-    int i;
+-    for(i = 0; i < 10; i++)
++    if(n > 2)
+     {
+-        printf("Your answer is: ");
+-        printf("%d\n", foo);
++        return fib(n-1) + fib(n-2);
+     }
++    return 1;
+ }
+ 
+-int fact(int n)
++// Frobs foo heartily
++int frobnitz(int foo)
+ {
+-    if(n > 1)
++    int i;
++    for(i = 0; i < 10; i++)
+     {
+-        return fact(n-1) * n;
++        printf("%d\n", foo);
+     }
+-    return 1;
+ }
+ 
+ int main(int argc, char **argv)
+ {
+-    frobnitz(fact(10));
++    frobnitz(fib(10));
+ }
+`},
+		{"prog.c", &TextDiffOptions{Algorithm: DiffPatience, Context: 3}, `diff --git a/prog.c b/prog.c
+index 6faa5a3..e3af329 100644
+--- a/prog.c
++++ b/prog.c
+@@ -1,26 +1,25 @@
+ #include <stdio.h>
+ 
++int fib(int n)
++{
++    if(n > 2)
++    {
++        return fib(n-1) + fib(n-2);
++    }
++    return 1;
++}
++
+ // Frobs foo heartily
+ int frobnitz(int foo)
+ {
+     int i;
+     for(i = 0; i < 10; i++)
+     {
+-        printf("Your answer is: ");
+         printf("%d\n", foo);
+     }
+ }
+ 
+-int fact(int n)
+-{
+-    if(n > 1)
+-    {
+-        return fact(n-1) * n;
+-    }
+-    return 1;
+-}
+-
+ int main(int argc, char **argv)
+ {
+-    frobnitz(fact(10));
++    frobnitz(fib(10));
+ }
+`},
+		{"prog.c", &TextDiffOptions{Algorithm: DiffHistogram, Context: 3}, `diff --git a/prog.c b/prog.c
+index 6faa5a3..e3af329 100644
+--- a/prog.c
++++ b/prog.c
+@@ -1,26 +1,25 @@
+ #include <stdio.h>
+ 
++int fib(int n)
++{
++    if(n > 2)
++    {
++        return fib(n-1) + fib(n-2);
++    }
++    return 1;
++}
++
+ // Frobs foo heartily
+ int frobnitz(int foo)
+ {
+     int i;
+     for(i = 0; i < 10; i++)
+     {
+-        printf("Your answer is: ");
+         printf("%d\n", foo);
+     }
+ }
+ 
+-int fact(int n)
+-{
+-    if(n > 1)
+-    {
+-        return fact(n-1) * n;
+-    }
+-    return 1;
+-}
+-
+ int main(int argc, char **argv)
+ {
+-    frobnitz(fact(10));
++    frobnitz(fib(10));
+ }
+`},
+		{"long.txt", &TextDiffOptions{Context: 1}, `diff --git a/long.txt b/long.txt
+index ac9837c..8438f15 100644
+--- a/long.txt
++++ b/long.txt
+@@ -2,3 +2,3 @@ line 1
+ line 2
+-line 3
++line three
+ line 4
+@@ -9,3 +9,3 @@ line 8
+ line 9
+-line 10
++line ten
+ line 11
+@@ -26,3 +26,3 @@ line 25
+ line 26
+-line 27
++line twenty-seven
+ line 28
+`},
+		{"tail.txt", nil, `diff --git a/tail.txt b/tail.txt
+index 54d55bf..f384549 100644
+--- a/tail.txt
++++ b/tail.txt
+@@ -1,3 +1,4 @@
+ one
+ two
+-three
+\ No newline at end of file
++three
++four
+`},
+		{"slide.txt", nil, `diff --git a/slide.txt b/slide.txt
+index de98044..5ee6b74 100644
+--- a/slide.txt
++++ b/slide.txt
+@@ -1,3 +1,4 @@
+ a
+ b
++b
+ c
+`},
+		{"bin.dat", nil, `diff --git a/bin.dat b/bin.dat
+index 00dd359..de268e2 100644
+Binary files a/bin.dat and b/bin.dat differ
+`},
+	}
+
+	for _, test := range tests {
+		diff, err := repo.DiffFile("main^", "main", test.path, test.opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, test.patch, diff.Patch(), test.path)
+	}
+}
+
+func TestDiffFileHunks(t *testing.T) {
+	repo := openTextDiff(t)
+	defer repo.Close()
+
+	diff, err := repo.DiffFile("main^", "main", "long.txt", &TextDiffOptions{Context: 1})
+	require.NoError(t, err)
+
+	assert.Equal(t, ChangeModified, diff.Kind)
+	assert.False(t, diff.Binary)
+	require.Equal(t, 3, len(diff.Hunks))
+
+	hunk := diff.Hunks[1]
+	assert.Equal(t, 9, hunk.OldStart)
+	assert.Equal(t, 3, hunk.OldLines)
+	assert.Equal(t, 9, hunk.NewStart)
+	assert.Equal(t, 3, hunk.NewLines)
+	assert.Equal(t, "line 8", hunk.Section)
+
+	assert.Equal(t, []*DiffLine{
+		{Op: DiffContext, Text: "line 9"},
+		{Op: DiffDelete, Text: "line 10"},
+		{Op: DiffInsert, Text: "line ten"},
+		{Op: DiffContext, Text: "line 11"},
+	}, hunk.Lines)
+
+	// Changes close enough together share a hunk
+	diff, err = repo.DiffFile("main^", "main", "long.txt", &TextDiffOptions{Context: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(diff.Hunks))
+
+	diff, err = repo.DiffFile("main^", "main", "tail.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(diff.Hunks))
+
+	lines := diff.Hunks[0].Lines
+	require.Equal(t, 5, len(lines))
+	assert.True(t, lines[2].NoNewline)
+	assert.False(t, lines[3].NoNewline)
+
+	diff, err = repo.DiffFile("main^", "main", "bin.dat", nil)
+	require.NoError(t, err)
+	assert.True(t, diff.Binary)
+	assert.Equal(t, 0, len(diff.Hunks))
+}
+
+func TestDiffFileAddedAndMissing(t *testing.T) {
+	repo := openTextDiff(t)
+	defer repo.Close()
+
+	diff, err := repo.DiffFile("", "main", "tail.txt", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, ChangeAdded, diff.Kind)
+	assert.Equal(t, `diff --git a/tail.txt b/tail.txt
+new file mode 100644
+index 0000000..f384549
+--- /dev/null
++++ b/tail.txt
+@@ -0,0 +1,4 @@
++one
++two
++three
++four
+`, diff.Patch())
+
+	diff, err = repo.DiffFile("main", "main^", "tail.txt", nil)
+	require.NoError(t, err)
+	assert.Equal(t, ChangeModified, diff.Kind)
+
+	diff, err = repo.DiffFile("main", "main", "prog.c", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(diff.Hunks))
+
+	_, err = repo.DiffFile("main^", "main", "nope.txt", nil)
+	assert.Equal(t, ErrNotExist, err)
+
+	history := openHistory(t)
+	defer history.Close()
+
+	_, err = history.DiffFile("main^", "main", "src", nil)
+	assert.Equal(t, ErrNotBlob, err)
+}
+
+func TestDiffBlobs(t *testing.T) {
+	repo := openTextDiff(t)
+	defer repo.Close()
+
+	diff, err := repo.DiffBlobs("54d55bf0bb50b503792f391b6f0158bd6145073e", "f384549cbeb481e437091320de6d1f2e15e11b4a", nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, diff.WritePatch(&out))
+
+	assert.Equal(t, `diff --git a/54d55bf0bb50b503792f391b6f0158bd6145073e b/f384549cbeb481e437091320de6d1f2e15e11b4a
+index 54d55bf..f384549 100644
+--- a/54d55bf0bb50b503792f391b6f0158bd6145073e
++++ b/f384549cbeb481e437091320de6d1f2e15e11b4a
+@@ -1,3 +1,4 @@
+ one
+ two
+-three
+\ No newline at end of file
++three
++four
+`, out.String())
+
+	_, err = repo.DiffBlobs("54d55bf0bb50b503792f391b6f0158bd6145073e", "eceec94ca7e7c543f20cda93c557d94a4a8bc568", nil)
+	assert.Equal(t, ErrNotBlob, err)
+}
+
+// Fails every write
+type failingWriter struct {
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestWritePatchError(t *testing.T) {
+	repo := openTextDiff(t)
+	defer repo.Close()
+
+	diff, err := repo.DiffBlobs("54d55bf0bb50b503792f391b6f0158bd6145073e", "f384549cbeb481e437091320de6d1f2e15e11b4a", nil)
+	require.NoError(t, err)
+
+	failed := errors.New("disk full")
+
+	assert.Equal(t, failed, diff.WritePatch(&failingWriter{failed}))
+}
+
+func TestDiffChange(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	changes, err := repo.DiffTrees("004e64b^", "004e64b")
+	require.NoError(t, err)
+
+	changes, err = repo.DetectRenames(changes, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(changes))
+
+	diff, err := repo.DiffChange(changes[0], nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, `diff --git a/src/util.go b/src/helpers.go
+similarity index 92%
+rename from src/util.go
+rename to src/helpers.go
+index 418bfd7..caeff44 100644
+--- a/src/util.go
++++ b/src/helpers.go
+@@ -2,7 +2,7 @@ package main
+ 
+ import "strings"
+ 
+-// Join the words together with spaces
++// Join words with spaces
+ func join(words []string) string {
+ 	return strings.Join(words, " ")
+ }
+`, diff.Patch())
+
+	// A file becoming a symlink is shown as one being deleted and the
+	// other created
+	changes, err = repo.DiffTrees("cee3b9d^", "cee3b9d")
+	require.NoError(t, err)
+	require.Equal(t, ChangeTypeChanged, changes[0].Kind)
+
+	diff, err = repo.DiffChange(changes[0], nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, len(diff.Hunks))
+	assert.Equal(t, `diff --git a/README b/README
+deleted file mode 100644
+index f470586..0000000
+--- a/README
++++ /dev/null
+@@ -1,3 +0,0 @@
+-# History
+-
+-A fixture repository.
+diff --git a/README b/README
+new file mode 120000
+index 0000000..eafc2aa
+--- /dev/null
++++ b/README
+@@ -0,0 +1 @@
++docs/guide.md
+\ No newline at end of file
+`, diff.Patch())
+}
@@ -0,0 +1,260 @@
+package gitreader
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// What happened to a path between two trees. The values are the
+// letters git diff --name-status uses.
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "A"
+	ChangeDeleted  ChangeKind = "D"
+	ChangeModified ChangeKind = "M"
+
+	// The path went from being one of a file, symlink or submodule
+	// to another
+	ChangeTypeChanged ChangeKind = "T"
+
+	// Found by DetectRenames. OldPath was moved or copied to Path.
+	ChangeRenamed ChangeKind = "R"
+	ChangeCopied  ChangeKind = "C"
+)
+
+// A path that differs between two trees. The mode and id of the side
+// the path doesn't exist on are empty.
+type Change struct {
+	Kind ChangeKind
+	Path string
+
+	// For renames and copies, where the file came from and how
+	// similar the two are as a percentage
+	OldPath string
+	Score   int
+
+	OldMode, NewMode string
+	OldId, NewId     string
+}
+
+// Format the change the way git diff-tree --raw does
+func (c *Change) String() string {
+	oldId, newId := c.OldId, c.NewId
+
+	if oldId == "" {
+		oldId = strings.Repeat("0", len(newId))
+	}
+
+	if newId == "" {
+		newId = strings.Repeat("0", len(oldId))
+	}
+
+	if c.Kind == ChangeRenamed || c.Kind == ChangeCopied {
+		return fmt.Sprintf(":%s %s %s %s %s%03d\t%s\t%s", rawMode(c.OldMode), rawMode(c.NewMode), oldId, newId, c.Kind, c.Score, c.OldPath, c.Path)
+	}
+
+	return fmt.Sprintf(":%s %s %s %s %s\t%s", rawMode(c.OldMode), rawMode(c.NewMode), oldId, newId, c.Kind, c.Path)
+}
+
+func rawMode(mode string) string {
+	if len(mode) < 6 {
+		return strings.Repeat("0", 6-len(mode)) + mode
+	}
+
+	return mode
+}
+
+// Compare two trees like git diff-tree -r, returning each file,
+// symlink and submodule that differs, in path order. Either side can
+// be a tree or a commit named by anything RevParse understands, and
+// an empty string stands for the empty tree. Subtrees with the same
+// id on both sides are skipped without being read.
+func (r *Repo) DiffTrees(oldRev, newRev string) ([]*Change, error) {
+	oldTree, err := r.resolveTree(oldRev)
+	if err != nil {
+		return nil, err
+	}
+
+	newTree, err := r.resolveTree(newRev)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.diffTrees(oldTree, newTree)
+}
+
+func (r *Repo) resolveTree(rev string) (string, error) {
+	if rev == "" {
+		return "", nil
+	}
+
+	id, err := r.RevParse(rev)
+	if err != nil {
+		return "", err
+	}
+
+	return r.peelTo(id, "tree")
+}
+
+func (r *Repo) diffTrees(oldTree, newTree string) ([]*Change, error) {
+	var changes []*Change
+
+	err := r.diffTree(oldTree, newTree, "", &changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// Add the differences between the trees oldTree and newTree, found
+// at prefix, to changes
+func (r *Repo) diffTree(oldTree, newTree, prefix string, changes *[]*Change) error {
+	if oldTree == newTree {
+		return nil
+	}
+
+	oldEntries, err := r.sortedEntries(oldTree)
+	if err != nil {
+		return err
+	}
+
+	newEntries, err := r.sortedEntries(newTree)
+	if err != nil {
+		return err
+	}
+
+	for len(oldEntries) > 0 || len(newEntries) > 0 {
+		var old, new *Entry
+
+		switch {
+		case len(newEntries) == 0:
+			old = oldEntries[0]
+		case len(oldEntries) == 0:
+			new = newEntries[0]
+		default:
+			oldKey := treeSortKey(oldEntries[0].Name, oldEntries[0].Permissions)
+			newKey := treeSortKey(newEntries[0].Name, newEntries[0].Permissions)
+
+			switch {
+			case oldKey < newKey:
+				old = oldEntries[0]
+			case oldKey > newKey:
+				new = newEntries[0]
+			default:
+				old, new = oldEntries[0], newEntries[0]
+			}
+		}
+
+		if old != nil {
+			oldEntries = oldEntries[1:]
+		}
+
+		if new != nil {
+			newEntries = newEntries[1:]
+		}
+
+		err := r.diffEntry(old, new, prefix, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add the differences between two entries with the same name to
+// changes. Either may be nil. Since a subtree sorts apart from a file
+// of the same name, both are trees or neither is.
+func (r *Repo) diffEntry(old, new *Entry, prefix string, changes *[]*Change) error {
+	switch {
+	case new == nil:
+		if isTreeMode(old.Permissions) {
+			return r.diffTree(old.Id, "", prefix+old.Name+"/", changes)
+		}
+
+		*changes = append(*changes, &Change{
+			Kind:    ChangeDeleted,
+			Path:    prefix + old.Name,
+			OldMode: old.Permissions,
+			OldId:   old.Id,
+		})
+	case old == nil:
+		if isTreeMode(new.Permissions) {
+			return r.diffTree("", new.Id, prefix+new.Name+"/", changes)
+		}
+
+		*changes = append(*changes, &Change{
+			Kind:    ChangeAdded,
+			Path:    prefix + new.Name,
+			NewMode: new.Permissions,
+			NewId:   new.Id,
+		})
+	case old.Id == new.Id && old.Permissions == new.Permissions:
+	case isTreeMode(old.Permissions):
+		return r.diffTree(old.Id, new.Id, prefix+new.Name+"/", changes)
+	default:
+		kind := ChangeModified
+		if modeType(old.Permissions) != modeType(new.Permissions) {
+			kind = ChangeTypeChanged
+		}
+
+		*changes = append(*changes, &Change{
+			Kind:    kind,
+			Path:    prefix + new.Name,
+			OldMode: old.Permissions,
+			NewMode: new.Permissions,
+			OldId:   old.Id,
+			NewId:   new.Id,
+		})
+	}
+
+	return nil
+}
+
+// Return the entries of the tree id in the order git keeps them. An
+// empty id stands for the empty tree.
+func (r *Repo) sortedEntries(id string) ([]*Entry, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	tree, err := r.loadTree(id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(tree.Entries))
+	for _, entry := range tree.Entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return treeSortKey(entries[i].Name, entries[i].Permissions) < treeSortKey(entries[j].Name, entries[j].Permissions)
+	})
+
+	return entries, nil
+}
+
+// Git sorts a subtree as if its name ended in a slash
+func treeSortKey(name, mode string) string {
+	if isTreeMode(mode) {
+		return name + "/"
+	}
+
+	return name
+}
+
+func isTreeMode(mode string) bool {
+	return modeType(mode) == 0040000
+}
+
+// Return the part of a mode that says whether an entry is a tree,
+// file, symlink or submodule
+func modeType(mode string) uint64 {
+	n, _ := strconv.ParseUint(mode, 8, 32)
+	return n & 0170000
+}
@@ -0,0 +1,84 @@
+package gitreader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rawChanges(changes []*Change) string {
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestDiffTrees(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	tests := []struct {
+		old, new string
+		raw      string
+	}{
+		{"2a6239a^", "2a6239a", `:100644 100644 d8fa929218fa6365064ddcfc4eb40ad3f8ed91c0 7ce968d3a141624ddfdc7dbb0c9eefc749d424b3 M	src/main.go`},
+		{"004e64b^", "004e64b", `:000000 100644 0000000000000000000000000000000000000000 caeff445e452771e965c39f8dfc02e862862566f A	src/helpers.go
+:100644 000000 418bfd7198a213be12b0258ef3461dcdf3db5544 0000000000000000000000000000000000000000 D	src/util.go`},
+		{"731d9a5^", "731d9a5", `:100644 100644 acc30f26da662f29b454f57cdcc9c4d9df8b08a7 b97fafb2d1384275d23c362e112032793d2810da M	docs/guide.md
+:100644 000000 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 0000000000000000000000000000000000000000 D	old/one.txt
+:100644 000000 23d7551c8807066404defd73664d74f13c37f342 0000000000000000000000000000000000000000 D	old/two.txt
+:000000 100644 0000000000000000000000000000000000000000 caeff445e452771e965c39f8dfc02e862862566f A	src/helpers_copy.go`},
+		{"ab168e9^", "ab168e9", `:000000 120000 0000000000000000000000000000000000000000 656dfc3f55927e2e845c06c3d626d03d4adf8d88 A	docs/latest
+:000000 100644 0000000000000000000000000000000000000000 b437676b0b69749e011e1353750ee9638acde8c1 A	logo.png
+:100644 100755 1d46b4fb938096013aab00ba630d124b8bcd3b9d 1d46b4fb938096013aab00ba630d124b8bcd3b9d M	scripts/build.sh`},
+		{"cee3b9d^", "cee3b9d", `:100644 120000 f4705862b3d061ff755fa5c54ef1e73dc52f630d eafc2aac7162cad4e1f335fab78ae18b297e49cc T	README
+:100644 100644 b437676b0b69749e011e1353750ee9638acde8c1 a80ba770ef1bde4b48403b666eaa3fc41113a070 M	logo.png`},
+		{"", "v0.1", `:000000 100644 0000000000000000000000000000000000000000 f4705862b3d061ff755fa5c54ef1e73dc52f630d A	README
+:000000 100644 0000000000000000000000000000000000000000 c540cb81a2e3a291c2955e235d2131366a65d935 A	docs/guide.md
+:000000 100644 0000000000000000000000000000000000000000 aaa876fbb1d019146f54fd9a5081a0b44a6752f3 A	old/one.txt
+:000000 100644 0000000000000000000000000000000000000000 23d7551c8807066404defd73664d74f13c37f342 A	old/two.txt
+:000000 100644 0000000000000000000000000000000000000000 1d46b4fb938096013aab00ba630d124b8bcd3b9d A	scripts/build.sh
+:000000 100644 0000000000000000000000000000000000000000 d8fa929218fa6365064ddcfc4eb40ad3f8ed91c0 A	src/main.go
+:000000 100644 0000000000000000000000000000000000000000 418bfd7198a213be12b0258ef3461dcdf3db5544 A	src/util.go`},
+		{"main", "main^{tree}", ""},
+	}
+
+	for _, test := range tests {
+		changes, err := repo.DiffTrees(test.old, test.new)
+		require.NoError(t, err)
+
+		assert.Equal(t, test.raw, rawChanges(changes), test.old+" "+test.new)
+	}
+
+	changes, err := repo.DiffTrees("v0.1", "main")
+	require.NoError(t, err)
+	assert.Equal(t, 14, len(changes))
+
+	_, err = repo.DiffTrees("main:README", "main")
+	assert.Equal(t, ErrNotTree, err)
+}
+
+func TestDiffTreesFileBecomesDirectory(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	// A file and a subtree of the same name are different entries, so
+	// the file is deleted and the subtree's files are added
+	src := &Entry{Name: "src", Permissions: "100644", Id: "d8fa929218fa6365064ddcfc4eb40ad3f8ed91c0"}
+
+	var changes []*Change
+	require.NoError(t, repo.diffEntry(src, nil, "", &changes))
+
+	srcTree, err := repo.Resolve("v0.1", "src")
+	require.NoError(t, err)
+
+	require.NoError(t, repo.diffEntry(nil, &Entry{Name: "src", Permissions: "40000", Id: srcTree}, "", &changes))
+
+	assert.Equal(t, `:100644 000000 d8fa929218fa6365064ddcfc4eb40ad3f8ed91c0 0000000000000000000000000000000000000000 D	src
+:000000 100644 0000000000000000000000000000000000000000 d8fa929218fa6365064ddcfc4eb40ad3f8ed91c0 A	src/main.go
+:000000 100644 0000000000000000000000000000000000000000 418bfd7198a213be12b0258ef3461dcdf3db5544 A	src/util.go`, rawChanges(changes))
+}
@@ -0,0 +1,80 @@
+package gitreader
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Returned when VerifyObjects is set and an object's content doesn't
+// hash to the id it was loaded by
+type CorruptObjectError struct {
+	Id string
+
+	// The Loader the object was read from
+	Loader Loader
+
+	// The id the content actually hashes to
+	Actual string
+}
+
+func (e *CorruptObjectError) Error() string {
+	return fmt.Sprintf("corrupt object %s in %s: content hashes to %s", e.Id, describeLoader(e.Loader), e.Actual)
+}
+
+// Return a description of where loader reads objects from
+func describeLoader(loader Loader) string {
+	switch l := loader.(type) {
+	case *LooseObject:
+		return "loose objects at " + l.dir()
+	case *Pack:
+		return "pack " + l.dataPath
+	case *MultiPackIndex:
+		return "multi-pack-index " + l.path
+	}
+
+	return fmt.Sprintf("%T", loader)
+}
+
+// Arrange for the body of obj to be hashed as it's read. Once all of
+// it has been read, a mismatch with id is returned in place of io.EOF.
+func verifyObject(obj *Object, id string, loader Loader, format *ObjectFormat) {
+	h := format.New()
+	fmt.Fprintf(h, "%s %d\x00", obj.Type, obj.Size)
+
+	obj.body = bufio.NewReader(&verifyReader{
+		r:      obj.body,
+		hash:   h,
+		id:     id,
+		loader: loader,
+	})
+}
+
+type verifyReader struct {
+	r      io.Reader
+	hash   hash.Hash
+	id     string
+	loader Loader
+	err    error
+}
+
+func (v *verifyReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+
+	if err == io.EOF {
+		if sum := hex.EncodeToString(v.hash.Sum(nil)); sum != v.id {
+			err = &CorruptObjectError{v.id, v.loader, sum}
+		}
+
+		v.err = err
+	}
+
+	return n, err
+}
@@ -0,0 +1,95 @@
+package gitreader
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyObjects(t *testing.T) {
+	for _, path := range []string{"fixtures/history.git", "fixtures/sha256.git"} {
+		repo, err := OpenRepo(path)
+		require.NoError(t, err)
+
+		defer repo.Close()
+
+		repo.VerifyObjects = true
+
+		id, err := repo.ResolveRef("HEAD")
+		require.NoError(t, err, path)
+
+		obj, err := repo.LoadObject(id)
+		require.NoError(t, err, path)
+
+		commit, err := obj.Commit()
+		require.NoError(t, err, path)
+
+		obj, err = repo.LoadObject(commit.Tree)
+		require.NoError(t, err, path)
+
+		_, err = obj.Tree()
+		require.NoError(t, err, path)
+	}
+}
+
+func TestVerifyObjectsCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	// "hello" is b6fc4c620b67d95f953a5c1c1230aaab5db5a1b0, but store
+	// it under the id of "hellp"
+	id := "39cc8d82f469e798ce1b8be2483079ee67db92db"
+
+	var compress bytes.Buffer
+
+	zw := zlib.NewWriter(&compress)
+	zw.Write([]byte("blob 5\x00hello"))
+	zw.Close()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "objects", id[:2]), 0755))
+
+	err = ioutil.WriteFile(filepath.Join(dir, "objects", id[:2], id[2:]), compress.Bytes(), 0644)
+	require.NoError(t, err)
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	obj, err := repo.LoadObject(id)
+	require.NoError(t, err)
+
+	blob, err := obj.Blob()
+	require.NoError(t, err)
+
+	data, err := blob.Bytes()
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", string(data))
+
+	repo.VerifyObjects = true
+
+	obj, err = repo.LoadObject(id)
+	require.NoError(t, err)
+
+	blob, err = obj.Blob()
+	require.NoError(t, err)
+
+	_, err = blob.Bytes()
+	require.IsType(t, &CorruptObjectError{}, err)
+
+	corrupt := err.(*CorruptObjectError)
+
+	assert.Equal(t, id, corrupt.Id)
+	assert.Equal(t, "b6fc4c620b67d95f953a5c1c1230aaab5db5a1b0", corrupt.Actual)
+	assert.IsType(t, &LooseObject{}, corrupt.Loader)
+	assert.Contains(t, corrupt.Error(), "loose objects at "+filepath.Join(dir, "objects"))
+}
@@ -0,0 +1,572 @@
+package gitreader
+
+import (
+	"container/heap"
+	"io"
+	"strings"
+)
+
+// The order a RevWalk returns commits in
+type RevSort int
+
+const (
+	// Newest committer date first, like git rev-list does by default.
+	// Commits are returned as soon as they're found.
+	SortDate RevSort = iota
+
+	// No commit comes before all of its children, and the commits of
+	// each line of history are kept together, like git rev-list
+	// --topo-order. The whole range is read before the first commit
+	// is returned.
+	SortTopo
+)
+
+// Walks the commits reachable from a set of starting points, like
+// git rev-list. Set the options before the first call to Next.
+type RevWalk struct {
+	Sort RevSort
+
+	// Only follow the first parent of merge commits
+	FirstParent bool
+
+	// Stop after returning this many commits. 0 means no limit.
+	MaxCount int
+
+	// Only return commits that change one of these paths compared to
+	// their parents, like git log -- paths. A merge that matches one
+	// of its parents at every path is left out, and only that parent
+	// is followed. The commit-graph's changed-path Bloom filters are
+	// used to skip comparing trees where they can.
+	Paths []string
+
+	repo   *Repo
+	starts []string
+	hidden []string
+
+	started bool
+	count   int
+
+	queue *commitQueue
+	flags map[string]walkFlags
+
+	// Parents read to compare their trees, kept until they're queued
+	nodes map[string]*queuedCommit
+
+	// When the walk is limited by hidden commits or sorted
+	// topologically, the commits to return are worked out up front
+	limited bool
+	output  []string
+	parents map[string][]string
+}
+
+type walkFlags uint8
+
+const (
+	walkSeen walkFlags = 1 << iota
+	walkUninteresting
+
+	// The commit doesn't change any of the walk's paths
+	walkTreesame
+)
+
+// How many more commits to read once only hidden commits are left
+// to walk, in case clock skew makes an older commit hide a newer one
+const walkSlop = 5
+
+// Create a RevWalk over the history of the repo
+func (r *Repo) NewRevWalk() *RevWalk {
+	return &RevWalk{
+		repo:    r,
+		queue:   &commitQueue{},
+		flags:   make(map[string]walkFlags),
+		nodes:   make(map[string]*queuedCommit),
+		parents: make(map[string][]string),
+	}
+}
+
+// Start walking from the commit named by rev
+func (w *RevWalk) Push(rev string) error {
+	id, err := w.repo.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	w.starts = append(w.starts, id)
+
+	return nil
+}
+
+// Leave out the commit named by rev and all of its ancestors
+func (w *RevWalk) Hide(rev string) error {
+	id, err := w.repo.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+
+	w.hidden = append(w.hidden, id)
+
+	return nil
+}
+
+// Add a revision or range in the syntax git rev-list accepts:
+//
+//	B        commits reachable from B
+//	^A       leave out the commits reachable from A
+//	A..B     commits reachable from B but not from A
+//	A...B    commits reachable from either A or B but not both
+//
+// An empty side of a range means HEAD.
+func (w *RevWalk) PushRange(spec string) error {
+	if i := strings.Index(spec, "..."); i != -1 {
+		one, err := w.repo.resolveCommit(orHead(spec[:i]))
+		if err != nil {
+			return err
+		}
+
+		two, err := w.repo.resolveCommit(orHead(spec[i+3:]))
+		if err != nil {
+			return err
+		}
+
+		bases, err := w.repo.mergeBases(one, []string{two})
+		if err != nil {
+			return err
+		}
+
+		w.starts = append(w.starts, one, two)
+		w.hidden = append(w.hidden, bases...)
+
+		return nil
+	}
+
+	if i := strings.Index(spec, ".."); i != -1 {
+		err := w.Hide(orHead(spec[:i]))
+		if err != nil {
+			return err
+		}
+
+		return w.Push(orHead(spec[i+2:]))
+	}
+
+	if strings.HasPrefix(spec, "^") {
+		return w.Hide(spec[1:])
+	}
+
+	return w.Push(spec)
+}
+
+func orHead(rev string) string {
+	if rev == "" {
+		return "HEAD"
+	}
+
+	return rev
+}
+
+// Return the next commit of the walk and its id. Returns io.EOF once
+// there are no more.
+func (w *RevWalk) Next() (string, *Commit, error) {
+	if w.MaxCount > 0 && w.count >= w.MaxCount {
+		return "", nil, io.EOF
+	}
+
+	if !w.started {
+		w.started = true
+
+		err := w.start()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	var (
+		id     string
+		commit *Commit
+		err    error
+	)
+
+	if w.limited {
+		if len(w.output) == 0 {
+			return "", nil, io.EOF
+		}
+
+		id = w.output[0]
+		w.output = w.output[1:]
+
+		commit, err = w.repo.loadCommit(id)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		var next *queuedCommit
+
+		for next == nil {
+			if w.queue.Len() == 0 {
+				return "", nil, io.EOF
+			}
+
+			next = heap.Pop(w.queue).(*queuedCommit)
+
+			err = w.pushParents(next)
+			if err != nil {
+				return "", nil, err
+			}
+
+			if w.flags[next.id]&walkTreesame != 0 {
+				next = nil
+			}
+		}
+
+		id, commit = next.id, next.commit
+
+		// Commits found in the commit-graph haven't been read yet
+		if commit == nil {
+			commit, err = w.repo.loadCommit(id)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	w.count++
+
+	return id, commit, nil
+}
+
+func (w *RevWalk) start() error {
+	for _, id := range w.hidden {
+		w.flags[id] |= walkUninteresting
+	}
+
+	for _, id := range append(w.starts, w.hidden...) {
+		err := w.add(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(w.hidden) > 0 || w.Sort == SortTopo {
+		return w.limit()
+	}
+
+	return nil
+}
+
+// Queue the commit id, unless it has been already
+func (w *RevWalk) add(id string) error {
+	if w.flags[id]&walkSeen != 0 {
+		return nil
+	}
+
+	w.flags[id] |= walkSeen
+
+	next, err := w.node(id)
+	if err != nil {
+		return err
+	}
+
+	delete(w.nodes, id)
+
+	heap.Push(w.queue, next)
+
+	return nil
+}
+
+// Read what the walk needs to know about the commit id. If it hasn't
+// been queued yet, it's kept for when it is.
+func (w *RevWalk) node(id string) (*queuedCommit, error) {
+	if next, ok := w.nodes[id]; ok {
+		return next, nil
+	}
+
+	next, err := w.repo.walkCommit(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.flags[id]&walkSeen == 0 {
+		w.nodes[id] = next
+	}
+
+	return next, nil
+}
+
+func (w *RevWalk) walkParents(next *queuedCommit) []string {
+	if w.FirstParent && len(next.parents) > 1 {
+		return next.parents[:1]
+	}
+
+	return next.parents
+}
+
+// Queue the parents of a commit taken off the queue, passing on
+// whether it is hidden
+func (w *RevWalk) pushParents(next *queuedCommit) error {
+	err := w.simplify(next)
+	if err != nil {
+		return err
+	}
+
+	hidden := w.flags[next.id]&walkUninteresting != 0
+
+	for _, parent := range w.walkParents(next) {
+		if hidden {
+			w.markUninteresting(parent)
+		}
+
+		err := w.add(parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Hide id, along with any of its ancestors that have been walked
+// already
+func (w *RevWalk) markUninteresting(id string) {
+	stack := []string{id}
+
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if w.flags[id]&walkUninteresting != 0 {
+			continue
+		}
+
+		w.flags[id] |= walkUninteresting
+		stack = append(stack, w.parents[id]...)
+	}
+}
+
+// Walk until only hidden commits are left, collecting the commits
+// that aren't hidden, then put them in order
+func (w *RevWalk) limit() error {
+	var list []string
+
+	slop := walkSlop
+
+	for w.queue.Len() > 0 {
+		next := heap.Pop(w.queue).(*queuedCommit)
+
+		err := w.pushParents(next)
+		if err != nil {
+			return err
+		}
+
+		w.parents[next.id] = w.walkParents(next)
+
+		if w.flags[next.id]&walkUninteresting != 0 {
+			if !w.everybodyUninteresting() {
+				slop = walkSlop
+				continue
+			}
+
+			slop--
+			if slop == 0 {
+				break
+			}
+
+			continue
+		}
+
+		list = append(list, next.id)
+	}
+
+	// Some commits may have been hidden after they were collected
+	for _, id := range list {
+		if w.flags[id]&walkUninteresting == 0 {
+			w.output = append(w.output, id)
+		}
+	}
+
+	if w.Sort == SortTopo {
+		w.output = w.topoSort(w.output)
+	}
+
+	// Commits that don't change the paths are only needed to sort
+	if len(w.Paths) > 0 {
+		var changed []string
+		for _, id := range w.output {
+			if w.flags[id]&walkTreesame == 0 {
+				changed = append(changed, id)
+			}
+		}
+
+		w.output = changed
+	}
+
+	w.limited = true
+
+	return nil
+}
+
+func (w *RevWalk) everybodyUninteresting() bool {
+	for _, item := range w.queue.items {
+		if w.flags[item.id]&walkUninteresting == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Order ids so that every commit comes before its parents. Like git,
+// a line of history is followed down as far as it can be before
+// moving on to the next.
+func (w *RevWalk) topoSort(ids []string) []string {
+	// The number of children of each commit, plus one so that zero
+	// means the commit isn't being sorted
+	indegree := make(map[string]int, len(ids))
+
+	for _, id := range ids {
+		indegree[id] = 1
+	}
+
+	for _, id := range ids {
+		for _, parent := range w.parents[id] {
+			if indegree[parent] > 0 {
+				indegree[parent]++
+			}
+		}
+	}
+
+	// The tips are pushed in reverse so that the first comes out first
+	var stack []string
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		if indegree[ids[i]] == 1 {
+			stack = append(stack, ids[i])
+		}
+	}
+
+	sorted := make([]string, 0, len(ids))
+
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		sorted = append(sorted, id)
+
+		for _, parent := range w.parents[id] {
+			if indegree[parent] == 0 {
+				continue
+			}
+
+			indegree[parent]--
+			if indegree[parent] == 1 {
+				stack = append(stack, parent)
+			}
+		}
+	}
+
+	return sorted
+}
+
+// When the walk is limited to paths, mark next walkTreesame if it
+// doesn't change them. A merge that matches one of its parents is
+// cut down to just that parent, as git does by default.
+func (w *RevWalk) simplify(next *queuedCommit) error {
+	if len(w.Paths) == 0 || w.flags[next.id]&walkUninteresting != 0 {
+		return nil
+	}
+
+	// A root commit changes the paths if it has any of them
+	if len(next.parents) == 0 {
+		same, err := w.sameTrees(next.tree, "")
+		if err != nil {
+			return err
+		}
+
+		if same {
+			w.flags[next.id] |= walkTreesame
+		}
+
+		return nil
+	}
+
+	for i, parent := range next.parents {
+		if w.FirstParent && i > 0 {
+			break
+		}
+
+		same, err := w.sameAsParent(next, parent, i == 0)
+		if err != nil {
+			return err
+		}
+
+		if same {
+			w.flags[next.id] |= walkTreesame
+			next.parents = []string{parent}
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Report whether next has the same entries at the walk's paths as
+// its parent. The Bloom filter of a commit only covers its changes
+// from its first parent.
+func (w *RevWalk) sameAsParent(next *queuedCommit, parent string, first bool) (bool, error) {
+	if first && w.repo.CommitGraph != nil && w.bloomRulesOut(next.id) {
+		return true, nil
+	}
+
+	parentNode, err := w.node(parent)
+	if err != nil {
+		return false, err
+	}
+
+	return w.sameTrees(next.tree, parentNode.tree)
+}
+
+// Report whether the Bloom filter of the commit id shows that it
+// changes none of the walk's paths
+func (w *RevWalk) bloomRulesOut(id string) bool {
+	for _, path := range w.Paths {
+		maybe, ok := w.repo.CommitGraph.MaybeChangedPath(id, path)
+		if !ok || maybe {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Report whether the trees a and b have the same entry at each of the
+// walk's paths. An empty id stands for the empty tree.
+func (w *RevWalk) sameTrees(a, b string) (bool, error) {
+	if a == b {
+		return true, nil
+	}
+
+	for _, path := range w.Paths {
+		entryA, err := w.repo.lookupEntry(a, path)
+		if err != nil {
+			return false, err
+		}
+
+		entryB, err := w.repo.lookupEntry(b, path)
+		if err != nil {
+			return false, err
+		}
+
+		if entryA == nil || entryB == nil {
+			if entryA != entryB {
+				return false, nil
+			}
+
+			continue
+		}
+
+		if entryA.Id != entryB.Id || entryA.Permissions != entryB.Permissions {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
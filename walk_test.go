@@ -0,0 +1,181 @@
+package gitreader
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run the walk to the end and return the commits as abbreviated ids
+func shortWalk(t *testing.T, w *RevWalk) string {
+	var ids []string
+
+	for {
+		id, commit, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+		require.NotNil(t, commit)
+
+		ids = append(ids, id[:7])
+	}
+
+	return strings.Join(ids, " ")
+}
+
+func openHistory(t *testing.T) *Repo {
+	repo, err := OpenRepo("fixtures/history.git")
+	require.NoError(t, err)
+
+	return repo
+}
+
+func TestRevWalkDateOrder(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	w := repo.NewRevWalk()
+	require.NoError(t, w.Push("main"))
+
+	assert.Equal(t, "cee3b9d ab168e9 731d9a5 004e64b 4ec79ca 631e210 5809308 f8ed0f8 c9a5789 7d4990f ea1410f 2a6239a 6672ee4", shortWalk(t, w))
+}
+
+func TestRevWalkTopoOrder(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	w := repo.NewRevWalk()
+	w.Sort = SortTopo
+	require.NoError(t, w.Push("main"))
+
+	assert.Equal(t, "cee3b9d ab168e9 731d9a5 004e64b 4ec79ca 631e210 5809308 f8ed0f8 7d4990f ea1410f c9a5789 2a6239a 6672ee4", shortWalk(t, w))
+
+	w = repo.NewRevWalk()
+	w.Sort = SortTopo
+	require.NoError(t, w.PushRange("main"))
+	require.NoError(t, w.PushRange("^ea1410f"))
+
+	assert.Equal(t, "cee3b9d ab168e9 731d9a5 004e64b 4ec79ca 631e210 5809308 f8ed0f8 7d4990f c9a5789", shortWalk(t, w))
+}
+
+func TestRevWalkFirstParent(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	w := repo.NewRevWalk()
+	w.FirstParent = true
+	require.NoError(t, w.Push("main"))
+
+	assert.Equal(t, "cee3b9d ab168e9 731d9a5 004e64b 4ec79ca f8ed0f8 c9a5789 2a6239a 6672ee4", shortWalk(t, w))
+}
+
+func TestRevWalkMaxCount(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	w := repo.NewRevWalk()
+	w.MaxCount = 3
+	require.NoError(t, w.Push("main"))
+
+	assert.Equal(t, "cee3b9d ab168e9 731d9a5", shortWalk(t, w))
+
+	_, _, err := w.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRevWalkRanges(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	tests := []struct {
+		specs []string
+		out   string
+	}{
+		{[]string{"stable..main"}, "cee3b9d ab168e9 731d9a5 004e64b 4ec79ca 631e210 5809308"},
+		{[]string{"stable.."}, "cee3b9d ab168e9 731d9a5 004e64b 4ec79ca 631e210 5809308"},
+		{[]string{"topic-a...topic-b"}, "631e210 5809308"},
+		{[]string{"feature...stable~1"}, "c9a5789 7d4990f ea1410f"},
+		{[]string{"topic-a", "topic-b", "^feature"}, "631e210 5809308 f8ed0f8 c9a5789"},
+		{[]string{"main..stable"}, ""},
+	}
+
+	for _, test := range tests {
+		w := repo.NewRevWalk()
+
+		for _, spec := range test.specs {
+			require.NoError(t, w.PushRange(spec))
+		}
+
+		assert.Equal(t, test.out, shortWalk(t, w), strings.Join(test.specs, " "))
+	}
+}
+
+func TestRevWalkPeelsTags(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	w := repo.NewRevWalk()
+	w.MaxCount = 1
+	require.NoError(t, w.Push("v1.0"))
+
+	assert.Equal(t, "f8ed0f8", shortWalk(t, w))
+
+	err := w.Push("v1.0^{tree}")
+	assert.Equal(t, ErrNotCommit, err)
+}
+
+func TestRevWalkPaths(t *testing.T) {
+	repo := openHistory(t)
+	defer repo.Close()
+
+	tests := []struct {
+		specs []string
+		paths []string
+		out   string
+	}{
+		{[]string{"main"}, []string{"a.txt"}, "5809308"},
+		{[]string{"main"}, []string{"src/main.go"}, "2a6239a 6672ee4"},
+		{[]string{"main"}, []string{"src"}, "731d9a5 004e64b 7d4990f ea1410f 2a6239a 6672ee4"},
+		{[]string{"main"}, []string{"docs/"}, "ab168e9 731d9a5 c9a5789 6672ee4"},
+		{[]string{"main"}, []string{"a.txt", "b.txt"}, "4ec79ca 631e210 5809308"},
+		{[]string{"main"}, []string{"nothere"}, ""},
+		{[]string{"stable..main"}, []string{"src"}, "731d9a5 004e64b"},
+	}
+
+	check := func() {
+		for _, test := range tests {
+			for _, sort := range []RevSort{SortDate, SortTopo} {
+				w := repo.NewRevWalk()
+				w.Sort = sort
+				w.Paths = test.paths
+
+				for _, spec := range test.specs {
+					require.NoError(t, w.PushRange(spec))
+				}
+
+				assert.Equal(t, test.out, shortWalk(t, w), strings.Join(test.paths, " "))
+			}
+		}
+
+		w := repo.NewRevWalk()
+		w.FirstParent = true
+		w.Paths = []string{"src"}
+		require.NoError(t, w.Push("main"))
+
+		assert.Equal(t, "731d9a5 004e64b f8ed0f8 2a6239a 6672ee4", shortWalk(t, w))
+	}
+
+	require.NotNil(t, repo.CommitGraph)
+	check()
+
+	// The same without the Bloom filters
+	repo.CommitGraph.Close()
+	repo.CommitGraph = nil
+
+	check()
+}
@@ -0,0 +1,115 @@
+package gitreader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenLinkedWorktree(t *testing.T) {
+	repo, err := OpenRepo("fixtures/history.git/worktrees/wt")
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	assert.Equal(t, filepath.Join("fixtures", "history.git"), repo.CommonDir)
+
+	// HEAD is per-worktree
+	id, err := repo.ResolveRef("HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "7d4990f38518569153e837970474000ac532def5", id)
+
+	id, err = repo.ResolveRef("ORIG_HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "c9a5789da1613be93d0eaba9a2cb7fb6c3b59f06", id)
+
+	// branches are shared
+	id, err = repo.ResolveRef("main")
+	require.NoError(t, err)
+
+	assert.Equal(t, "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8", id)
+
+	id, err = repo.ResolveRef("main-worktree/HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "cee3b9d4362bedd7bc110f59ebb0ed3aeab529a8", id)
+
+	refs, err := repo.Refs("refs/bisect/")
+	require.NoError(t, err)
+
+	expected := []*Ref{
+		{Name: "refs/bisect/bad", Id: "2a6239aef5a6073d9030e99ce84030a0f32470b9"},
+	}
+
+	assert.Equal(t, expected, refs)
+}
+
+func TestOpenRepoGitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	wt, err := filepath.Abs("fixtures/history.git/worktrees/wt")
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+wt+"\n"), 0644)
+	require.NoError(t, err)
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	id, err := repo.ResolveRef("HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "7d4990f38518569153e837970474000ac532def5", id)
+}
+
+func TestOpenRepoRelativeGitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	bare, err := filepath.Abs("fixtures/proj.git")
+	require.NoError(t, err)
+
+	rel, err := filepath.Rel(dir, bare)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+rel+"\n"), 0644)
+	require.NoError(t, err)
+
+	repo, err := OpenRepo(dir)
+	require.NoError(t, err)
+
+	defer repo.Close()
+
+	assert.Equal(t, repo.Base, repo.CommonDir)
+
+	id, err := repo.ResolveRef("HEAD")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bdae0e92f4a7ca0ec05b6c2decab9dc18361750b", id)
+}
+
+func TestOpenRepoBadGitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitreader")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, ".git"), []byte("not a gitdir\n"), 0644)
+	require.NoError(t, err)
+
+	_, err = OpenRepo(dir)
+	assert.Equal(t, ErrInvalidRepo, err)
+}